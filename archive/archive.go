@@ -1,12 +1,25 @@
 package archive
 
-import "os"
+import (
+	"io/fs"
+	"time"
+)
 
 // File struct contains bytes body and the provided name field.
+//
+// Mode holds the permission bits and, for symbolic links, fs.ModeSymlink.
+// Linkname is the target of a symbolic link, or of a hard link when Mode
+// is not a symbolic link. Uid and Gid are only stored in TAR archives.
+// Method is the compression method of a ZIP entry.
 type File struct {
-	Name  string
-	Body  []byte
-	IsDir bool
+	Name     string
+	Body     []byte
+	IsDir    bool
+	Mode     fs.FileMode
+	ModTime  time.Time
+	Linkname string
+	Uid, Gid int
+	Method   Method
 }
 
 // Format represents the archive format.
@@ -15,19 +28,67 @@ type Format int
 const (
 	// ZIP format
 	ZIP Format = iota
-	// TAR format
+	// TAR format compressed with gzip
 	TAR
+	// PlainTAR format without compression
+	PlainTAR
+	// TARBZ2 format compressed with bzip2, only supported by Unpack
+	TARBZ2
+	// TARXZ format compressed with xz
+	TARXZ
+	// TARZST format compressed with zstd
+	TARZST
 )
 
-func readFiles(files ...string) (fs []File, err error) {
-	for _, f := range files {
-		var file File
-		file.Name = f
-		file.Body, err = os.ReadFile(f)
-		if err != nil {
-			return
-		}
-		fs = append(fs, file)
+// modeMask is the part of fs.FileMode kept in File and Header.
+const modeMask = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky | fs.ModeSymlink
+
+// Method represents the compression method of a ZIP entry.
+type Method int
+
+const (
+	// DefaultMethod compresses with Deflate, unless Packer.StoreIncompressible
+	// finds the entry incompressible.
+	DefaultMethod Method = iota
+	// Store stores the entry without compression.
+	Store
+	// Deflate compresses the entry with Deflate.
+	Deflate
+)
+
+func (f *File) header() *Header {
+	return &Header{
+		Name:     f.Name,
+		Size:     int64(len(f.Body)),
+		IsDir:    f.IsDir,
+		Mode:     f.Mode,
+		ModTime:  f.ModTime,
+		Linkname: f.Linkname,
+		Uid:      f.Uid,
+		Gid:      f.Gid,
+		Method:   f.Method,
 	}
-	return
+}
+
+func (h *Header) file() File {
+	return File{
+		Name:     h.Name,
+		IsDir:    h.IsDir,
+		Mode:     h.Mode,
+		ModTime:  h.ModTime,
+		Linkname: h.Linkname,
+		Uid:      h.Uid,
+		Gid:      h.Gid,
+		Method:   h.Method,
+	}
+}
+
+// isSymlink reports whether the entry is a symbolic link.
+func (h *Header) isSymlink() bool {
+	return h.Mode&fs.ModeSymlink != 0
+}
+
+// isHardLink reports whether the entry is a hard link.
+func (h *Header) isHardLink() bool {
+	return h.Linkname != "" && !h.isSymlink() && !h.IsDir
 }
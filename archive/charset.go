@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// unicodePathExtraID is the ID of the Info-ZIP Unicode Path extra field.
+const unicodePathExtraID = 0x7075
+
+// zipName returns the name of f decoded to UTF-8. Names without the UTF-8
+// flag are taken from the Unicode Path extra field if it is valid,
+// or else decoded with charset, if not nil.
+func zipName(f *zip.File, charset encoding.Encoding) string {
+	if !f.NonUTF8 {
+		return f.Name
+	}
+	if name, ok := unicodePath(f.Extra, f.Name); ok {
+		return name
+	}
+	if charset == nil {
+		return f.Name
+	}
+	if name, err := charset.NewDecoder().String(f.Name); err == nil {
+		return name
+	}
+
+	return f.Name
+}
+
+// unicodePath returns the name stored in the Unicode Path extra field,
+// if its checksum matches the raw name.
+func unicodePath(extra []byte, raw string) (string, bool) {
+	for len(extra) >= 4 {
+		id, size := binary.LittleEndian.Uint16(extra), int(binary.LittleEndian.Uint16(extra[2:]))
+		extra = extra[4:]
+		if size > len(extra) {
+			break
+		}
+		field := extra[:size]
+		extra = extra[size:]
+
+		if id != unicodePathExtraID || len(field) < 5 || field[0] != 1 {
+			continue
+		}
+		if binary.LittleEndian.Uint32(field[1:]) == crc32.ChecksumIEEE([]byte(raw)) && utf8.Valid(field[5:]) {
+			return string(field[5:]), true
+		}
+	}
+
+	return "", false
+}
+
+// unicodePathExtra returns a Unicode Path extra field storing name,
+// for an entry whose raw name is raw.
+func unicodePathExtra(name, raw string) []byte {
+	b := make([]byte, 9, 9+len(name))
+	binary.LittleEndian.PutUint16(b, unicodePathExtraID)
+	binary.LittleEndian.PutUint16(b[2:], uint16(5+len(name)))
+	b[4] = 1
+	binary.LittleEndian.PutUint32(b[5:], crc32.ChecksumIEEE([]byte(raw)))
+
+	return append(b, name...)
+}
+
+// encodeName encodes the name of fh with charset, if not nil and able to
+// represent it, keeping the UTF-8 name in a Unicode Path extra field.
+// Otherwise the name is stored in UTF-8 with the UTF-8 flag.
+func encodeName(fh *zip.FileHeader, charset encoding.Encoding) {
+	if charset == nil || isASCII(fh.Name) {
+		return
+	}
+	raw, err := charset.NewEncoder().String(fh.Name)
+	if err != nil {
+		return
+	}
+	fh.Extra = append(fh.Extra, unicodePathExtra(fh.Name, raw)...)
+	fh.Name, fh.NonUTF8 = raw, true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// detectCharset guesses the charset of the names of the entries lacking
+// the UTF-8 flag. It returns nil if they are all valid UTF-8.
+// Shift-JIS is chosen if the names decode to Japanese kana, GBK if they
+// decode cleanly, and CP437, the original ZIP charset, otherwise.
+func detectCharset(files []*zip.File) encoding.Encoding {
+	var names [][]byte
+	for _, f := range files {
+		if f.NonUTF8 && !utf8.ValidString(f.Name) {
+			if _, ok := unicodePath(f.Extra, f.Name); !ok {
+				names = append(names, []byte(f.Name))
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	if kana, ok := decodeAll(japanese.ShiftJIS, names); ok && kana {
+		return japanese.ShiftJIS
+	}
+	if _, ok := decodeAll(simplifiedchinese.GBK, names); ok {
+		return simplifiedchinese.GBK
+	}
+
+	return charmap.CodePage437
+}
+
+// decodeAll reports whether all names decode without error using charset,
+// and whether the result contains full-width Japanese kana without any
+// half-width katakana, which Chinese names decoded as Shift-JIS produce.
+func decodeAll(charset encoding.Encoding, names [][]byte) (kana, ok bool) {
+	for _, name := range names {
+		b, err := charset.NewDecoder().Bytes(name)
+		if err != nil || bytes.ContainsRune(b, utf8.RuneError) {
+			return false, false
+		}
+		for _, r := range string(b) {
+			switch {
+			case r >= 0xff61 && r <= 0xff9f:
+				return false, false
+			case r >= 0x3040 && r <= 0x30ff:
+				kana = true
+			}
+		}
+	}
+
+	return kana, true
+}
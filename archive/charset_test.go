@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// legacyZip returns a zip whose entry names are encoded with charset,
+// without the UTF-8 flag.
+func legacyZip(t *testing.T, charset encoding.Encoding, names ...string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range names {
+		raw, err := charset.NewEncoder().String(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: raw, NonUTF8: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestZipCharset(t *testing.T) {
+	tc := []struct {
+		charset encoding.Encoding
+		names   []string
+	}{
+		{simplifiedchinese.GBK, []string{"中文.txt", "目录/文件.txt"}},
+		{japanese.ShiftJIS, []string{"日本語のファイル.txt", "テスト.txt"}},
+		{charmap.CodePage437, []string{"café.txt", "naïve.txt"}},
+	}
+	for _, i := range tc {
+		b := legacyZip(t, i.charset, i.names...)
+		for _, u := range []*Unpacker{{}, {Charset: i.charset}} {
+			fs, err := u.Unpack(bytes.NewReader(b))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j, f := range fs {
+				if f.Name != i.names[j] {
+					t.Errorf("expected %q; got %q", i.names[j], f.Name)
+				}
+			}
+		}
+	}
+}
+
+func TestPackCharset(t *testing.T) {
+	name := "中文.txt"
+	for _, charset := range []encoding.Encoding{nil, simplifiedchinese.GBK} {
+		var buf bytes.Buffer
+		if err := (&Packer{Charset: charset}).Pack(&buf, ZIP, File{Name: name, Body: []byte("1")}); err != nil {
+			t.Fatal(err)
+		}
+
+		zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		f := zr.File[0]
+		if charset == nil {
+			if f.Flags&0x800 == 0 || f.Name != name {
+				t.Errorf("expected UTF-8 name %q; got %q (flags %#x)", name, f.Name, f.Flags)
+			}
+		} else if raw, _ := charset.NewEncoder().String(name); f.Name != raw {
+			t.Errorf("expected raw name %q; got %q", raw, f.Name)
+		}
+
+		// The Unicode Path extra field takes precedence over the charset.
+		fs, err := (&Unpacker{Charset: japanese.ShiftJIS}).Unpack(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fs[0].Name != name {
+			t.Errorf("expected %q; got %q", name, fs[0].Name)
+		}
+	}
+}
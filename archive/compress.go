@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	tarMagic   = "\x1f\x8b\x08?"
+	bzip2Magic = "BZh"
+	xzMagic    = "\xfd7zXZ\x00"
+	zstdMagic  = "\x28\xb5\x2f\xfd"
+)
+
+// plainTARMagic matches the "ustar" magic at offset 257 of a tar header.
+var plainTARMagic = strings.Repeat("?", 257) + "ustar"
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// compressor returns a WriteCloser compressing to w for the TAR based format.
+// Level and concurrency only apply to gzip, zero means the default level.
+func compressor(w io.Writer, format Format, level, concurrency int) (io.WriteCloser, error) {
+	switch format {
+	case TAR:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		if concurrency > 1 {
+			return newParallelGzipWriter(w, level, concurrency)
+		}
+		return gzip.NewWriterLevel(w, level)
+	case PlainTAR:
+		return nopWriteCloser{w}, nil
+	case TARXZ:
+		return xz.NewWriter(w)
+	case TARZST:
+		return zstd.NewWriter(w)
+	default:
+		return nil, errors.New("unknow format")
+	}
+}
+
+// decompressor returns a ReadCloser decompressing r for the TAR based format.
+func decompressor(r io.Reader, format Format) (io.ReadCloser, error) {
+	switch format {
+	case TAR:
+		return gzip.NewReader(r)
+	case PlainTAR:
+		return io.NopCloser(r), nil
+	case TARBZ2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case TARXZ:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case TARZST:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	default:
+		return nil, errors.New("unknow format")
+	}
+}
@@ -0,0 +1,417 @@
+package archive
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+var (
+	// ErrPasswordRequired is returned when reading an encrypted entry
+	// without a password.
+	ErrPasswordRequired = errors.New("archive: password required")
+	// ErrWrongPassword is returned when reading an encrypted entry
+	// with a wrong password.
+	ErrWrongPassword = errors.New("archive: wrong password")
+)
+
+// Encryption represents the WinZip AES encryption strength of ZIP entries.
+type Encryption int
+
+const (
+	// AES256 encrypts with 256-bit AES.
+	AES256 Encryption = iota
+	// AES192 encrypts with 192-bit AES.
+	AES192
+	// AES128 encrypts with 128-bit AES.
+	AES128
+)
+
+const (
+	// aesMethod is the compression method of WinZip AES encrypted entries.
+	aesMethod = 99
+	// aesExtraID is the ID of the WinZip AES extra field.
+	aesExtraID = 0x9901
+	// aesAuthLen is the length of the authentication code.
+	aesAuthLen = 10
+	// aesIterations is the PBKDF2 iteration count.
+	aesIterations = 1000
+)
+
+// strength returns the AES strength code, as stored in the extra field.
+func (e Encryption) strength() byte {
+	switch e {
+	case AES128:
+		return 1
+	case AES192:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// aesKeyLen returns the key length of the AES strength code.
+func aesKeyLen(strength byte) int {
+	return 8 + 8*int(strength)
+}
+
+// aesKeys derives the encryption key, authentication key
+// and password verification value from password and salt.
+func aesKeys(password string, salt []byte, keyLen int) (key, authKey, verifier []byte) {
+	b := pbkdf2.Key([]byte(password), salt, aesIterations, 2*keyLen+2, sha1.New)
+
+	return b[:keyLen], b[keyLen : 2*keyLen], b[2*keyLen:]
+}
+
+// aesExtra returns the WinZip AES extra field.
+func aesExtra(strength byte, method uint16) []byte {
+	b := make([]byte, 11)
+	binary.LittleEndian.PutUint16(b, aesExtraID)
+	binary.LittleEndian.PutUint16(b[2:], 7)
+	binary.LittleEndian.PutUint16(b[4:], 1) // AE-1, the CRC is stored
+	copy(b[6:], "AE")
+	b[8] = strength
+	binary.LittleEndian.PutUint16(b[9:], method)
+
+	return b
+}
+
+// parseAESExtra returns the vendor version, the AES strength code
+// and the actual compression method from the extra fields.
+func parseAESExtra(extra []byte) (version uint16, strength byte, method uint16, ok bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		if id == aesExtraID && size >= 7 {
+			return binary.LittleEndian.Uint16(extra[4:]), extra[8], binary.LittleEndian.Uint16(extra[9:]), true
+		}
+		extra = extra[4+size:]
+	}
+
+	return
+}
+
+// ctr is AES in the counter mode used by WinZip,
+// with a little-endian counter starting at 1.
+type ctr struct {
+	block   cipher.Block
+	counter [aes.BlockSize]byte
+	stream  [aes.BlockSize]byte
+	pos     int
+}
+
+func newCTR(key []byte) (*ctr, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ctr{block: block, pos: aes.BlockSize}, nil
+}
+
+func (c *ctr) XORKeyStream(dst, src []byte) {
+	for i := range src {
+		if c.pos == aes.BlockSize {
+			for j := range c.counter {
+				c.counter[j]++
+				if c.counter[j] != 0 {
+					break
+				}
+			}
+			c.block.Encrypt(c.stream[:], c.counter[:])
+			c.pos = 0
+		}
+		dst[i] = src[i] ^ c.stream[c.pos]
+		c.pos++
+	}
+}
+
+// aesWriter encrypts the compressed data of a WinZip AES entry.
+type aesWriter struct {
+	w      io.Writer
+	comp   io.WriteCloser
+	ctr    *ctr
+	mac    hash.Hash
+	header []byte
+	buf    []byte
+}
+
+// newAESWriter returns a WriteCloser compressing with method and
+// encrypting to w. The salt and the password verification value
+// are written before the data, as the local file header is written
+// after the compressor is created.
+func newAESWriter(w io.Writer, password string, strength byte, method uint16, level int) (io.WriteCloser, error) {
+	keyLen := aesKeyLen(strength)
+	salt := make([]byte, keyLen/2)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, authKey, verifier := aesKeys(password, salt, keyLen)
+	c, err := newCTR(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aw := &aesWriter{w: w, ctr: c, mac: hmac.New(sha1.New, authKey), header: append(salt, verifier...)}
+	switch method {
+	case zip.Store:
+		aw.comp = nopWriteCloser{writerFunc(aw.encrypt)}
+	case zip.Deflate:
+		if level == 0 {
+			level = flate.DefaultCompression
+		}
+		if aw.comp, err = flate.NewWriter(writerFunc(aw.encrypt), level); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+
+	return aw, nil
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) { return f(b) }
+
+func (w *aesWriter) writeHeader() error {
+	if w.header == nil {
+		return nil
+	}
+	_, err := w.w.Write(w.header)
+	w.header = nil
+
+	return err
+}
+
+func (w *aesWriter) encrypt(b []byte) (int, error) {
+	if err := w.writeHeader(); err != nil {
+		return 0, err
+	}
+	w.buf = append(w.buf[:0], b...)
+	w.ctr.XORKeyStream(w.buf, w.buf)
+	w.mac.Write(w.buf)
+
+	return w.w.Write(w.buf)
+}
+
+func (w *aesWriter) Write(b []byte) (int, error) {
+	return w.comp.Write(b)
+}
+
+func (w *aesWriter) Close() error {
+	if err := w.comp.Close(); err != nil {
+		return err
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	_, err := w.w.Write(w.mac.Sum(nil)[:aesAuthLen])
+
+	return err
+}
+
+// openEncrypted opens the encrypted zip entry f with password.
+func openEncrypted(f *zip.File, password string) (io.ReadCloser, error) {
+	if password == "" {
+		return nil, fmt.Errorf("%w: %s", ErrPasswordRequired, f.Name)
+	}
+
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader
+	method, checkCRC := f.Method, true
+	if f.Method == aesMethod {
+		version, strength, actual, ok := parseAESExtra(f.Extra)
+		if !ok || strength < 1 || strength > 3 {
+			return nil, zip.ErrFormat
+		}
+		if r, err = newAESReader(raw, f, password, strength); err != nil {
+			return nil, err
+		}
+		// AE-2 does not store the CRC.
+		method, checkCRC = actual, version == 1
+	} else if r, err = newZipCryptoReader(raw, f, password); err != nil {
+		return nil, err
+	}
+
+	var rc io.ReadCloser
+	switch method {
+	case zip.Store:
+		rc = io.NopCloser(r)
+	case zip.Deflate:
+		rc = flate.NewReader(r)
+	default:
+		return nil, zip.ErrAlgorithm
+	}
+
+	return &checksumReader{rc: rc, src: r, f: f, checkCRC: checkCRC, hash: crc32.NewIEEE()}, nil
+}
+
+// aesReader decrypts the data of a WinZip AES entry
+// and checks the authentication code at the end.
+type aesReader struct {
+	r    io.Reader
+	raw  io.Reader
+	ctr  *ctr
+	mac  hash.Hash
+	done bool
+}
+
+func newAESReader(raw io.Reader, f *zip.File, password string, strength byte) (*aesReader, error) {
+	keyLen := aesKeyLen(strength)
+	header := make([]byte, keyLen/2+2)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+	size := int64(f.CompressedSize64) - int64(len(header)) - aesAuthLen
+	if size < 0 {
+		return nil, zip.ErrFormat
+	}
+
+	key, authKey, verifier := aesKeys(password, header[:keyLen/2], keyLen)
+	if subtle.ConstantTimeCompare(verifier, header[keyLen/2:]) != 1 {
+		return nil, fmt.Errorf("%w: %s", ErrWrongPassword, f.Name)
+	}
+	c, err := newCTR(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &aesReader{r: io.LimitReader(raw, size), raw: raw, ctr: c, mac: hmac.New(sha1.New, authKey)}, nil
+}
+
+func (r *aesReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.mac.Write(b[:n])
+	r.ctr.XORKeyStream(b[:n], b[:n])
+	if err == io.EOF && !r.done {
+		r.done = true
+		code := make([]byte, aesAuthLen)
+		if _, err := io.ReadFull(r.raw, code); err != nil {
+			return n, err
+		}
+		if !hmac.Equal(code, r.mac.Sum(nil)[:aesAuthLen]) {
+			return n, zip.ErrChecksum
+		}
+	}
+
+	return n, err
+}
+
+// zipCrypto holds the keys of the traditional PKWARE encryption.
+type zipCrypto struct {
+	keys [3]uint32
+}
+
+func newZipCrypto(password string) *zipCrypto {
+	z := &zipCrypto{[3]uint32{0x12345678, 0x23456789, 0x34567890}}
+	for i := 0; i < len(password); i++ {
+		z.update(password[i])
+	}
+
+	return z
+}
+
+func crc32Update(crc uint32, b byte) uint32 {
+	return crc32.IEEETable[byte(crc)^b] ^ crc>>8
+}
+
+func (z *zipCrypto) update(b byte) {
+	z.keys[0] = crc32Update(z.keys[0], b)
+	z.keys[1] = (z.keys[1]+z.keys[0]&0xff)*134775813 + 1
+	z.keys[2] = crc32Update(z.keys[2], byte(z.keys[1]>>24))
+}
+
+func (z *zipCrypto) decrypt(b []byte) {
+	for i, c := range b {
+		t := z.keys[2] | 2
+		c ^= byte(t * (t ^ 1) >> 8)
+		z.update(c)
+		b[i] = c
+	}
+}
+
+type zipCryptoReader struct {
+	r io.Reader
+	z *zipCrypto
+}
+
+func newZipCryptoReader(raw io.Reader, f *zip.File, password string) (*zipCryptoReader, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(raw, header); err != nil {
+		return nil, err
+	}
+
+	z := newZipCrypto(password)
+	z.decrypt(header)
+	// The last byte of the header is the high byte of the CRC, or
+	// of the modification time if the entry has a data descriptor.
+	check := byte(f.CRC32 >> 24)
+	if f.Flags&0x8 != 0 {
+		check = byte(f.ModifiedTime >> 8)
+	}
+	if header[11] != check {
+		return nil, fmt.Errorf("%w: %s", ErrWrongPassword, f.Name)
+	}
+
+	return &zipCryptoReader{r: raw, z: z}, nil
+}
+
+func (r *zipCryptoReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.z.decrypt(b[:n])
+
+	return n, err
+}
+
+// checksumReader checks the size and the CRC, if checkCRC is set,
+// of the decompressed data. It drains src at the end, so that
+// the authentication code of AES entries is always checked.
+type checksumReader struct {
+	rc       io.ReadCloser
+	src      io.Reader
+	f        *zip.File
+	checkCRC bool
+	hash     hash.Hash32
+	n        uint64
+}
+
+func (r *checksumReader) Read(b []byte) (int, error) {
+	n, err := r.rc.Read(b)
+	r.hash.Write(b[:n])
+	r.n += uint64(n)
+	if err == io.EOF {
+		if _, err := io.Copy(io.Discard, r.src); err != nil {
+			return n, err
+		}
+		if r.n != r.f.UncompressedSize64 || r.checkCRC && r.hash.Sum32() != r.f.CRC32 {
+			return n, zip.ErrChecksum
+		}
+	}
+
+	return n, err
+}
+
+func (r *checksumReader) Close() error {
+	return r.rc.Close()
+}
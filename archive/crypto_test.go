@@ -0,0 +1,87 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestAES(t *testing.T) {
+	files := []File{
+		{Name: "dir", IsDir: true},
+		{Name: "dir/stored", Body: []byte("stored"), Method: Store},
+		{Name: "dir/deflated", Body: bytes.Repeat([]byte("deflated"), 1000)},
+		{Name: "empty"},
+	}
+	for _, encryption := range []Encryption{AES256, AES192, AES128} {
+		var buf bytes.Buffer
+		if err := (&Packer{Password: "secret", Encryption: encryption}).Pack(&buf, ZIP, files...); err != nil {
+			t.Fatal(err)
+		}
+
+		fs, err := (&Unpacker{Password: "secret"}).Unpack(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range fs {
+			if fs[i].Name != files[i].Name+map[bool]string{true: "/"}[files[i].IsDir] ||
+				!bytes.Equal(fs[i].Body, files[i].Body) {
+				t.Errorf("expected %q(%q); got %q(%q)", files[i].Name, files[i].Body, fs[i].Name, fs[i].Body)
+			}
+		}
+
+		if _, err := Unpack(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrPasswordRequired) {
+			t.Errorf("expected ErrPasswordRequired; got %v", err)
+		}
+		if _, err := (&Unpacker{Password: "wrong"}).Unpack(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("expected ErrWrongPassword; got %v", err)
+		}
+
+		// Tampering with the encrypted data fails authentication.
+		b := bytes.Clone(buf.Bytes())
+		i := bytes.Index(b, []byte("dir/deflated")) + len("dir/deflated") + 11 + 16 + 2 + 10
+		b[i] ^= 0xff
+		if _, err := (&Unpacker{Password: "secret"}).Unpack(bytes.NewReader(b)); err == nil {
+			t.Error("expected error; got nil")
+		}
+	}
+
+	if err := (&Packer{Password: "secret"}).Pack(&bytes.Buffer{}, TAR, files...); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
+
+func TestZipCrypto(t *testing.T) {
+	for name, expected := range map[string][]File{
+		"testdata/crypto.zip": {
+			{Name: "1.txt", Body: []byte("1")},
+			{Name: "2.txt", Body: []byte("2")},
+		},
+		"testdata/crypto-stream.zip": {
+			{Name: "1.txt", Body: []byte("1")},
+		},
+	} {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fs, err := (&Unpacker{Password: "secret"}).Unpack(bytes.NewReader(b))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(fs) != len(expected) {
+			t.Fatalf("%s: expected %d files; got %d", name, len(expected), len(fs))
+		}
+		for i := range fs {
+			if fs[i].Name != expected[i].Name || !bytes.Equal(fs[i].Body, expected[i].Body) {
+				t.Errorf("expected %q(%q); got %q(%q)", expected[i].Name, expected[i].Body, fs[i].Name, fs[i].Body)
+			}
+		}
+
+		if _, err := (&Unpacker{Password: "wrong"}).Unpack(bytes.NewReader(b)); !errors.Is(err, ErrWrongPassword) {
+			t.Errorf("%s: expected ErrWrongPassword; got %v", name, err)
+		}
+	}
+}
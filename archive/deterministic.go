@@ -0,0 +1,65 @@
+package archive
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"time"
+)
+
+// epoch is the default modification time of deterministic entries,
+// the earliest time a ZIP archive can store.
+var epoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// modTime returns the modification time of deterministic entries.
+func (p *Packer) modTime() (time.Time, error) {
+	if !p.ModTime.IsZero() {
+		return p.ModTime.UTC().Truncate(time.Second), nil
+	}
+	if s := os.Getenv("SOURCE_DATE_EPOCH"); s != "" {
+		sec, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("archive: invalid SOURCE_DATE_EPOCH %q", s)
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+
+	return epoch, nil
+}
+
+// deterministicWriter normalizes the metadata of the entries it writes.
+type deterministicWriter struct {
+	Writer
+	modTime time.Time
+}
+
+func (w *deterministicWriter) WriteHeader(hdr *Header) error {
+	return w.Writer.WriteHeader(w.normalize(hdr))
+}
+
+func (w *deterministicWriter) copyRaw(e *rawEntry) error {
+	entry := *e
+	entry.header, entry.normalize = w.normalize(e.header), true
+
+	return w.Writer.(rawCopier).copyRaw(&entry)
+}
+
+// normalize returns a copy of hdr with normalized metadata.
+func (w *deterministicWriter) normalize(hdr *Header) *Header {
+	header := *hdr
+	header.ModTime = w.modTime
+	header.Uid, header.Gid = 0, 0
+	switch {
+	case header.IsDir:
+		header.Mode = 0755
+	case header.isSymlink():
+		header.Mode = fs.ModeSymlink | 0777
+	case header.Mode&0111 != 0:
+		header.Mode = 0755
+	default:
+		header.Mode = 0644
+	}
+
+	return &header
+}
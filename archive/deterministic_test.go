@@ -0,0 +1,81 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDeterministic(t *testing.T) {
+	p := &Packer{Deterministic: true}
+	a := []File{
+		{Name: "b.txt", Body: []byte("b"), Mode: 0600, ModTime: time.Now(), Uid: 1000},
+		{Name: "a", IsDir: true, Mode: 0700, ModTime: time.Now()},
+		{Name: "a/run.sh", Body: []byte("#!/bin/sh"), Mode: 0700},
+	}
+	b := []File{
+		{Name: "a/run.sh", Body: []byte("#!/bin/sh"), Mode: 0750, ModTime: time.Unix(1, 0)},
+		{Name: "a", IsDir: true, Mode: 0755},
+		{Name: "b.txt", Body: []byte("b"), Mode: 0640, Gid: 1000},
+	}
+	for _, format := range []Format{ZIP, TAR, PlainTAR, TARXZ, TARZST} {
+		var bufA, bufB bytes.Buffer
+		if err := p.Pack(&bufA, format, a...); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Pack(&bufB, format, b...); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(bufA.Bytes(), bufB.Bytes()) {
+			t.Errorf("%s: expected identical output", format)
+		}
+
+		fs, err := Unpack(bytes.NewReader(bufA.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fs[0].Name != "a/" || fs[1].Mode != 0755 || fs[2].Mode != 0644 || !fs[2].ModTime.Equal(epoch) {
+			t.Errorf("%s: unexpected entries %#v", format, fs)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var bufA, bufB bytes.Buffer
+	if err := p.PackDir(&bufA, TAR, dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), time.Time{}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.PackDir(&bufB, TAR, dir); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bufA.Bytes(), bufB.Bytes()) {
+		t.Error("PackDir: expected identical output")
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+	var buf bytes.Buffer
+	if err := (&Packer{Deterministic: true}).Pack(&buf, ZIP, files...); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := Unpack(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := time.Unix(1700000000, 0); !fs[0].ModTime.Equal(expected) {
+		t.Errorf("expected %v; got %v", expected, fs[0].ModTime)
+	}
+
+	t.Setenv("SOURCE_DATE_EPOCH", "invalid")
+	if err := (&Packer{Deterministic: true}).Pack(&buf, ZIP, files...); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
@@ -0,0 +1,254 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// PackDir creates an archive from the directory tree rooted at root.
+// Entries are named relative to root.
+func PackDir(w io.Writer, format Format, root string) error {
+	return defaultPacker.PackDir(w, format, root)
+}
+
+// PackFS creates an archive from the file system fsys.
+func PackFS(w io.Writer, format Format, fsys fs.FS) error {
+	return defaultPacker.PackFS(w, format, fsys)
+}
+
+// PackDir creates an archive from the directory tree rooted at root.
+// Entries are named relative to root.
+func (p *Packer) PackDir(w io.Writer, format Format, root string) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("archive: %q is not a directory", root)
+	}
+
+	return p.PackFS(w, format, os.DirFS(root))
+}
+
+// PackFS creates an archive from the file system fsys.
+// Symbolic links are preserved if fsys implements
+// ReadLink(name string) (string, error), as os.DirFS does.
+// Otherwise, they are followed.
+func (p *Packer) PackFS(w io.Writer, format Format, fsys fs.FS) error {
+	aw, err := p.NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	walker := &walker{p: p, aw: aw, fsys: fsys, written: make(map[string]bool)}
+	for _, i := range p.Include {
+		if err := walker.include.add("", i); err != nil {
+			return err
+		}
+	}
+	for _, i := range p.Exclude {
+		if err := walker.exclude.add("", i); err != nil {
+			return err
+		}
+	}
+
+	if err := walker.walk("."); err != nil {
+		return err
+	}
+
+	return aw.Close()
+}
+
+type walker struct {
+	p    *Packer
+	aw   Writer
+	fsys fs.FS
+
+	include, exclude, ignore matcher
+
+	// written records the directories already written, as directories
+	// are only written once a file inside them is included.
+	written map[string]bool
+	// followed records the directories entered through symbolic links,
+	// to detect loops.
+	followed []fs.FileInfo
+}
+
+func (w *walker) walk(root string) error {
+	if info, err := fs.Stat(w.fsys, root); err == nil {
+		for _, i := range w.followed {
+			if os.SameFile(i, info) {
+				return fmt.Errorf("archive: symbolic link loop at %q", root)
+			}
+		}
+		w.followed = append(w.followed, info)
+		defer func() { w.followed = w.followed[:len(w.followed)-1] }()
+	}
+
+	return fs.WalkDir(w.fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return w.readIgnore(name)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if info, err = w.resolve(name, info); err != nil {
+				return err
+			}
+		}
+
+		excluded := w.exclude.match(name, info.IsDir())
+		if excluded || w.ignore.match(name, info.IsDir()) {
+			reason := "ignored"
+			if excluded {
+				reason = "excluded"
+			}
+			skipped(w.p.OnEvent, &Header{Name: path.Join(w.p.Prefix, name), IsDir: info.IsDir()}, reason)
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			if w.included(name) {
+				if err := w.writeDir(name, info); err != nil {
+					return err
+				}
+			}
+			if !d.IsDir() {
+				// A followed symbolic link to a directory.
+				return w.walk(name)
+			}
+			return w.readIgnore(name)
+		}
+
+		if !w.included(name) {
+			skipped(w.p.OnEvent, &Header{Name: path.Join(w.p.Prefix, name), Size: info.Size()}, "not included")
+			return nil
+		}
+
+		return w.writeFile(name, info)
+	})
+}
+
+// resolve returns the file info to pack for the symbolic link name.
+func (w *walker) resolve(name string, info fs.FileInfo) (fs.FileInfo, error) {
+	if !w.p.FollowSymlinks {
+		if _, ok := w.fsys.(interface {
+			ReadLink(string) (string, error)
+		}); ok {
+			return info, nil
+		}
+	}
+
+	return fs.Stat(w.fsys, name)
+}
+
+func (w *walker) readIgnore(dir string) error {
+	if w.p.IgnoreFile == "" {
+		return nil
+	}
+
+	f, err := w.fsys.Open(path.Join(dir, w.p.IgnoreFile))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	return w.ignore.read(dir, f)
+}
+
+// included reports whether name, or a directory containing it, is included.
+func (w *walker) included(name string) bool {
+	if len(w.p.Include) == 0 {
+		return true
+	}
+	for _, dir := range parents(name) {
+		if w.include.match(dir, true) {
+			return true
+		}
+	}
+
+	return w.include.match(name, false) || w.include.match(name, true)
+}
+
+func (w *walker) writeDir(name string, info fs.FileInfo) error {
+	if w.written[name] {
+		return nil
+	}
+	if err := w.writeParents(name); err != nil {
+		return err
+	}
+
+	header, err := infoHeader(path.Join(w.p.Prefix, name), info)
+	if err != nil {
+		return err
+	}
+	w.written[name] = true
+
+	return w.aw.WriteHeader(header)
+}
+
+// writeParents writes the parent directories of name not written yet.
+func (w *walker) writeParents(name string) error {
+	for _, dir := range parents(name) {
+		if w.written[dir] {
+			continue
+		}
+		info, err := fs.Stat(w.fsys, dir)
+		if err != nil {
+			return err
+		}
+		if err := w.writeDir(dir, info); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (w *walker) writeFile(name string, info fs.FileInfo) error {
+	if err := w.writeParents(name); err != nil {
+		return err
+	}
+
+	header, err := infoHeader(path.Join(w.p.Prefix, name), info)
+	if err != nil {
+		return err
+	}
+	if header.isSymlink() {
+		if header.Linkname, err = w.fsys.(interface {
+			ReadLink(string) (string, error)
+		}).ReadLink(name); err != nil {
+			return err
+		}
+		return w.aw.WriteHeader(header)
+	}
+
+	f, err := w.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := w.aw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(w.aw, f)
+
+	return err
+}
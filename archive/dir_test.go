@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"testing/fstest"
+)
+
+func testTree(t *testing.T) string {
+	root := t.TempDir()
+	for name, body := range map[string]string{
+		".gitignore":    "*.log\n!keep.log\nbuild/\n",
+		"a.txt":         "a",
+		"b.log":         "b",
+		"keep.log":      "keep",
+		"build/out":     "out",
+		"src/main.go":   "main",
+		"src/sub/x.go":  "x",
+		"src/sub/y.tmp": "y",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("src/main.go", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("src", filepath.Join(root, "dirlink")); err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+func entryNames(t *testing.T, b []byte) (names []string) {
+	fs, err := Unpack(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fs {
+		name := f.Name
+		if f.Linkname != "" {
+			name += "@"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+func TestPackDir(t *testing.T) {
+	root := testTree(t)
+	tc := []struct {
+		packer   Packer
+		expected []string
+	}{
+		{
+			Packer{IgnoreFile: ".gitignore", Exclude: []string{"*.tmp"}},
+			[]string{".gitignore", "a.txt", "dirlink@", "keep.log", "link@", "src/", "src/main.go", "src/sub/", "src/sub/x.go"},
+		},
+		{
+			Packer{Include: []string{"*.go"}, Prefix: "proj"},
+			[]string{"proj/src/", "proj/src/main.go", "proj/src/sub/", "proj/src/sub/x.go"},
+		},
+		{
+			Packer{Include: []string{"/src/sub"}, Exclude: []string{"x.go"}},
+			[]string{"src/", "src/sub/", "src/sub/y.tmp"},
+		},
+		{
+			Packer{FollowSymlinks: true, Exclude: []string{"build", "src", "*.log", "**/*.tmp"}},
+			[]string{".gitignore", "a.txt", "dirlink/", "dirlink/main.go", "dirlink/sub/", "dirlink/sub/x.go", "link"},
+		},
+	}
+	for _, format := range []Format{ZIP, TAR} {
+		for _, i := range tc {
+			var buf bytes.Buffer
+			if err := i.packer.PackDir(&buf, format, root); err != nil {
+				t.Fatal(err)
+			}
+			if names := entryNames(t, buf.Bytes()); !reflect.DeepEqual(names, i.expected) {
+				t.Errorf("%+v: expected %q; got %q", i.packer, i.expected, names)
+			}
+		}
+	}
+}
+
+func TestPackDirLoop(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Symlink(".", filepath.Join(root, "loop")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := (&Packer{FollowSymlinks: true}).PackDir(&buf, TAR, root); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
+
+func TestPackFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.txt":     {Data: []byte("a"), Mode: 0644},
+		"dir/b.txt": {Data: []byte("b"), Mode: 0600},
+	}
+	var buf bytes.Buffer
+	if err := PackFS(&buf, ZIP, fsys); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"a.txt", "dir/", "dir/b.txt"}
+	if names := entryNames(t, buf.Bytes()); !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %q; got %q", expected, names)
+	}
+}
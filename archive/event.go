@@ -0,0 +1,144 @@
+package archive
+
+// EventType is the type of an Event.
+type EventType int
+
+const (
+	// EntryStart is sent before an entry is processed.
+	EntryStart EventType = iota
+	// EntryProgress is sent when bytes of the entry's contents are processed.
+	EntryProgress
+	// EntryDone is sent after an entry is processed.
+	EntryDone
+	// EntrySkipped is sent when an entry is skipped, instead of EntryDone.
+	EntrySkipped
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EntryStart:
+		return "start"
+	case EntryProgress:
+		return "progress"
+	case EntryDone:
+		return "done"
+	case EntrySkipped:
+		return "skipped"
+	default:
+		return "unknown"
+	}
+}
+
+// Event reports the progress of packing or unpacking an entry.
+type Event struct {
+	Type   EventType
+	Header *Header
+	Bytes  int64  // Bytes is the number of bytes processed, for EntryProgress.
+	Reason string // Reason is why the entry was skipped, for EntrySkipped.
+}
+
+// eventReader sends the events of the entries read.
+type eventReader struct {
+	Reader
+	onEvent func(Event)
+	header  *Header // current entry, until it is done or skipped
+}
+
+func (r *eventReader) Next() (*Header, error) {
+	r.done(EntryDone, "")
+	header, err := r.Reader.Next()
+	if err != nil {
+		return nil, err
+	}
+	// The caller may modify header, like UnpackToFiles does.
+	h := *header
+	r.header = &h
+	r.onEvent(Event{Type: EntryStart, Header: r.header})
+
+	return header, nil
+}
+
+func (r *eventReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if n > 0 && r.header != nil {
+		r.onEvent(Event{Type: EntryProgress, Header: r.header, Bytes: int64(n)})
+	}
+
+	return n, err
+}
+
+// done ends the current entry, if any, with an event of type t.
+func (r *eventReader) done(t EventType, reason string) {
+	if r.header != nil {
+		r.onEvent(Event{Type: t, Header: r.header, Reason: reason})
+		r.header = nil
+	}
+}
+
+// skipEntry reports the current entry of ar as skipped.
+func skipEntry(ar Reader, reason string) {
+	if r, ok := ar.(*eventReader); ok {
+		r.done(EntrySkipped, reason)
+	}
+}
+
+// eventWriter sends the events of the entries written.
+type eventWriter struct {
+	Writer
+	onEvent func(Event)
+	header  *Header // current entry, until it is done
+}
+
+func (w *eventWriter) WriteHeader(hdr *Header) error {
+	w.done()
+	w.header = hdr
+	w.onEvent(Event{Type: EntryStart, Header: hdr})
+
+	return w.Writer.WriteHeader(hdr)
+}
+
+func (w *eventWriter) copyRaw(e *rawEntry) error {
+	w.done()
+	w.header = e.header
+	w.onEvent(Event{Type: EntryStart, Header: e.header})
+	if err := w.Writer.(rawCopier).copyRaw(e); err != nil {
+		return err
+	}
+	if !e.header.IsDir && e.header.Size > 0 {
+		w.onEvent(Event{Type: EntryProgress, Header: e.header, Bytes: e.header.Size})
+	}
+
+	return nil
+}
+
+func (w *eventWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	if n > 0 && w.header != nil {
+		w.onEvent(Event{Type: EntryProgress, Header: w.header, Bytes: int64(n)})
+	}
+
+	return n, err
+}
+
+func (w *eventWriter) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		return err
+	}
+	w.done()
+
+	return nil
+}
+
+func (w *eventWriter) done() {
+	if w.header != nil {
+		w.onEvent(Event{Type: EntryDone, Header: w.header})
+		w.header = nil
+	}
+}
+
+// skipped sends an EntrySkipped event, if onEvent is set.
+func skipped(onEvent func(Event), header *Header, reason string) {
+	if onEvent != nil {
+		onEvent(Event{Type: EntrySkipped, Header: header, Reason: reason})
+	}
+}
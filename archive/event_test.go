@@ -0,0 +1,59 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEvents(t *testing.T) {
+	var events []string
+	onEvent := func(e Event) {
+		s := fmt.Sprintf("%s %s", e.Type, e.Header.Name)
+		switch e.Type {
+		case EntryProgress:
+			s += fmt.Sprint(" ", e.Bytes)
+		case EntrySkipped:
+			s += " " + e.Reason
+		}
+		events = append(events, s)
+	}
+
+	var buf bytes.Buffer
+	if err := (&Packer{OnEvent: onEvent}).Pack(&buf, TAR,
+		File{Name: "a.txt", Body: []byte("abc")},
+		File{Name: "dir", IsDir: true},
+		File{Name: "b.log", Body: []byte("b")},
+	); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"start a.txt", "progress a.txt 3", "done a.txt",
+		"start dir", "done dir",
+		"start b.log", "progress b.log 1", "done b.log",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %q; got %q", expected, events)
+	}
+
+	events = nil
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "a.txt"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	u := &Unpacker{Exclude: []string{"*.log"}, Overwrite: SkipExisting, OnEvent: onEvent}
+	if err := u.UnpackToFiles(bytes.NewReader(buf.Bytes()), dest); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"start a.txt", "skipped a.txt file exists",
+		"start dir/", "done dir/",
+		"skipped b.log excluded",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %q; got %q", expected, events)
+	}
+}
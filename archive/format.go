@@ -0,0 +1,182 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// PackFunc creates a Writer writing an archive to w.
+type PackFunc func(w io.Writer) (Writer, error)
+
+// UnpackFunc creates a Reader reading an archive from r.
+type UnpackFunc func(r io.Reader) (Reader, error)
+
+// A format holds an archive format's name, magic header
+// and how to pack and unpack it. Built-in formats honor
+// the options of Packer and Unpacker.
+type format struct {
+	id          Format
+	name, magic string
+	exts        []string
+	pack        func(io.Writer, *Packer) (Writer, error)
+	unpack      func(io.Reader, *Unpacker) (Reader, error)
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   []*format
+)
+
+// RegisterFormat registers an archive format for use by Pack and Unpack,
+// and returns the Format to pass to Pack.
+//
+// Name is the name of the format, like "zip" or "tar.gz". It is also used
+// as the file extension when the magic bytes are ambiguous or unknown.
+// Magic is the magic prefix that identifies the format's encoding. The magic
+// string can contain "?" wildcards that each match any one byte. A format
+// with an empty magic is only matched by file extension, when no magic
+// matches. Either packer or unpacker may be nil
+// if the format can only be unpacked or packed.
+//
+// Formats are matched in registration order, after the built-in formats.
+func RegisterFormat(name, magic string, packer PackFunc, unpacker UnpackFunc) Format {
+	var pack func(io.Writer, *Packer) (Writer, error)
+	if packer != nil {
+		pack = func(w io.Writer, _ *Packer) (Writer, error) { return packer(w) }
+	}
+	var unpack func(io.Reader, *Unpacker) (Reader, error)
+	if unpacker != nil {
+		unpack = func(r io.Reader, _ *Unpacker) (Reader, error) { return unpacker(r) }
+	}
+
+	return registerFormat(name, magic, pack, unpack)
+}
+
+func registerFormat(
+	name, magic string,
+	pack func(io.Writer, *Packer) (Writer, error),
+	unpack func(io.Reader, *Unpacker) (Reader, error),
+	exts ...string,
+) Format {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	formats = append(formats, &format{
+		id:     Format(len(formats)),
+		name:   name,
+		magic:  magic,
+		exts:   append([]string{"." + name}, exts...),
+		pack:   pack,
+		unpack: unpack,
+	})
+
+	return Format(len(formats) - 1)
+}
+
+func init() {
+	registerFormat("zip", zipMagic,
+		func(w io.Writer, p *Packer) (Writer, error) { return newZipWriter(w, p), nil },
+		func(r io.Reader, u *Unpacker) (Reader, error) { return newZipReader(r, u) },
+	)
+	for _, i := range []struct {
+		format      Format
+		name, magic string
+		exts        []string
+	}{
+		{TAR, "tar.gz", tarMagic, []string{".tgz"}},
+		{PlainTAR, "tar", plainTARMagic, nil},
+		{TARBZ2, "tar.bz2", bzip2Magic, []string{".tbz2", ".tbz"}},
+		{TARXZ, "tar.xz", xzMagic, []string{".txz"}},
+		{TARZST, "tar.zst", zstdMagic, []string{".tzst"}},
+	} {
+		format := i.format
+		var pack func(io.Writer, *Packer) (Writer, error)
+		if format != TARBZ2 {
+			pack = func(w io.Writer, p *Packer) (Writer, error) { return newTarWriter(w, format, p) }
+		}
+		if registerFormat(i.name, i.magic, pack,
+			func(r io.Reader, u *Unpacker) (Reader, error) { return newTarReader(r, format, u.OnEvent) },
+			i.exts...,
+		) != format {
+			panic("archive: built-in formats registered out of order")
+		}
+	}
+}
+
+func (f Format) String() string {
+	if i := lookup(f); i != nil {
+		return i.name
+	}
+
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+func lookup(f Format) *format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	if f < 0 || int(f) >= len(formats) {
+		return nil
+	}
+
+	return formats[f]
+}
+
+// maxMagic returns the length of the longest registered magic.
+func maxMagic() int {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	n := 16
+	for _, f := range formats {
+		n = max(n, len(f.magic))
+	}
+
+	return n
+}
+
+// detect returns the format of an archive starting with b.
+// If several formats, or none, match b, the extension of name decides.
+// Otherwise the first registered match wins.
+func detect(b []byte, name string) *format {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	var candidates []*format
+	for _, f := range formats {
+		if f.magic != "" && match(f.magic, b) {
+			candidates = append(candidates, f)
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+
+	if name != "" {
+		name = strings.ToLower(name)
+		pool := candidates
+		if len(pool) == 0 {
+			pool = formats
+		}
+		var best *format
+		var bestLen int
+		for _, f := range pool {
+			for _, ext := range f.exts {
+				if strings.HasSuffix(name, strings.ToLower(ext)) && len(ext) > bestLen {
+					best, bestLen = f, len(ext)
+				}
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegisterFormat(t *testing.T) {
+	var unpacked []string
+	unpacker := func(name string) UnpackFunc {
+		return func(r io.Reader) (Reader, error) {
+			unpacked = append(unpacked, name)
+			return newZipReader(r, &Unpacker{})
+		}
+	}
+	myzip := RegisterFormat("myzip", zipMagic, nil, unpacker("myzip"))
+	RegisterFormat("noMagic", "", nil, unpacker("noMagic"))
+
+	if s := myzip.String(); s != "myzip" {
+		t.Errorf("expected %q; got %q", "myzip", s)
+	}
+	if s := TAR.String(); s != "tar.gz" {
+		t.Errorf("expected %q; got %q", "tar.gz", s)
+	}
+	if _, err := NewWriter(&bytes.Buffer{}, myzip); err == nil {
+		t.Error("expected error; got nil")
+	}
+
+	var buf bytes.Buffer
+	if err := Pack(&buf, ZIP, files...); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"a.zip", "a.myzip", "a.MYZIP", "a.nomagic"} {
+		if err := os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tc := []struct {
+		name     string
+		expected []string
+	}{
+		{"a.zip", nil},
+		{"a.myzip", []string{"myzip"}},
+		{"a.MYZIP", []string{"myzip"}},
+		// Magic bytes take precedence over an extension without matching magic.
+		{"a.nomagic", nil},
+	}
+	for _, i := range tc {
+		unpacked = nil
+		f, err := os.Open(filepath.Join(dir, i.name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs, err := Unpack(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fs) != len(files) {
+			t.Errorf("%s: expected %d files; got %d", i.name, len(files), len(fs))
+		}
+		if len(unpacked) != len(i.expected) || (len(unpacked) > 0 && unpacked[0] != i.expected[0]) {
+			t.Errorf("%s: expected %q; got %q", i.name, i.expected, unpacked)
+		}
+	}
+
+	// Without a name, the built-in zip format wins.
+	unpacked = nil
+	if _, err := Unpack(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if len(unpacked) != 0 {
+		t.Errorf("expected built-in zip; got %q", unpacked)
+	}
+
+	// Without matching magic, the extension decides.
+	if err := os.WriteFile(filepath.Join(dir, "b.nomagic"), []byte("unknown"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(dir, "b.nomagic"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	unpacked = nil
+	Unpack(f)
+	if len(unpacked) != 1 || unpacked[0] != "noMagic" {
+		t.Errorf("expected %q; got %q", "noMagic", unpacked)
+	}
+}
@@ -0,0 +1,512 @@
+package archive
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+const maxSymlinks = 40
+
+// OpenFS returns a read-only file system of the archive read from r,
+// which is size bytes long. The archive format is detected like in NewReader.
+//
+// The returned fs.FS implements fs.ReadDirFS, fs.StatFS and fs.ReadLinkFS,
+// and its files implement io.Seeker, so it can be used with http.FS,
+// template.ParseFS or fs.WalkDir. Directories implied by entry names are
+// synthesized, entries with non-local names are left out and when a name
+// occurs more than once, the last entry wins.
+// ZIP entries are read directly from r. Entries of other formats are
+// decompressed once into a temporary file, which is removed when the fs.FS
+// is closed with its Close method, or else when it is garbage collected.
+func OpenFS(r io.ReaderAt, size int64) (fs.FS, error) {
+	return defaultUnpacker.OpenFS(r, size)
+}
+
+// OpenFS returns a read-only file system of the archive read from r
+// like OpenFS, using the options of u. The limits of u are checked
+// while the archive is indexed, and the entry size limit while files
+// are read as well.
+func (u *Unpacker) OpenFS(r io.ReaderAt, size int64) (fs.FS, error) {
+	b := make([]byte, min(int64(maxMagic()), size))
+	if _, err := r.ReadAt(b, 0); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	f := detect(b, fileName(r))
+	if f == nil || f.unpack == nil {
+		return nil, errors.New("unsupport file format")
+	}
+
+	lr, limit := u.limit(io.NewSectionReader(r, 0, size))
+	ar, err := f.unpack(lr, u)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	fsys := &archiveFS{entries: map[string]*fsEntry{
+		".": {header: &Header{Name: ".", IsDir: true, Mode: fs.ModeDir | 0755}},
+	}}
+	if zr, ok := ar.(*zipReader); ok {
+		err = fsys.indexZip(zr, u, size)
+	} else {
+		err = fsys.index(limit(ar))
+	}
+	if err != nil {
+		fsys.Close()
+		return nil, err
+	}
+	fsys.link()
+
+	return fsys, nil
+}
+
+type archiveFS struct {
+	entries map[string]*fsEntry
+	links   []string // names of hard links, in archive order
+	spool   *spool
+}
+
+type fsEntry struct {
+	header   *Header
+	open     func() (io.ReadCloser, error)
+	children []fs.DirEntry
+}
+
+// spool is a temporary file holding the decompressed contents of entries.
+type spool struct {
+	f    *os.File
+	size int64
+}
+
+func newSpool() (*spool, error) {
+	f, err := os.CreateTemp("", "archive-fs-")
+	if err != nil {
+		return nil, err
+	}
+	s := &spool{f: f}
+	runtime.SetFinalizer(s, (*spool).close)
+
+	return s, nil
+}
+
+// write appends the contents of r and returns how to open them.
+func (s *spool) write(r io.Reader) (func() (io.ReadCloser, error), error) {
+	offset := s.size
+	n, err := io.Copy(s.f, r)
+	s.size += n
+	if err != nil {
+		return nil, err
+	}
+
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(io.NewSectionReader(s.f, offset, n)), nil
+	}, nil
+}
+
+func (s *spool) close() error {
+	runtime.SetFinalizer(s, nil)
+	s.f.Close()
+
+	return os.Remove(s.f.Name())
+}
+
+func (fsys *archiveFS) indexZip(zr *zipReader, u *Unpacker, size int64) error {
+	var total int64
+	for i, f := range zr.zr.File {
+		declared := &Header{Name: f.Name, Size: int64(min(f.UncompressedSize64, math.MaxInt64))}
+		if err := u.checkHeader(i+1, declared); err != nil {
+			return err
+		}
+		total += declared.Size
+		if err := u.checkTotal(total, size); err != nil {
+			return err
+		}
+
+		header, ok, err := zr.header(f)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fsys.add(header, func() (io.ReadCloser, error) {
+				rc, err := zr.open(f)
+				if err != nil {
+					return nil, err
+				}
+				return u.limitEntry(rc), nil
+			})
+		}
+	}
+
+	return nil
+}
+
+// index reads the entries of ar, spooling the contents of regular files.
+func (fsys *archiveFS) index(ar Reader) error {
+	for {
+		header, err := ar.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if header.IsDir || header.Linkname != "" {
+			fsys.add(header, nil)
+			continue
+		}
+		if fsys.spool == nil {
+			if fsys.spool, err = newSpool(); err != nil {
+				return err
+			}
+		}
+		open, err := fsys.spool.write(ar)
+		if err != nil {
+			return err
+		}
+		fsys.add(header, open)
+	}
+}
+
+// Close removes the temporary file holding the decompressed contents
+// of entries, if any. Files of fsys can no longer be read afterwards.
+func (fsys *archiveFS) Close() error {
+	if fsys.spool == nil {
+		return nil
+	}
+
+	return fsys.spool.close()
+}
+
+// add adds the entry of header, creating its missing parent directories.
+func (fsys *archiveFS) add(header *Header, open func() (io.ReadCloser, error)) {
+	name := clean(header.Name)
+	if name == "." || !fs.ValidPath(name) {
+		return
+	}
+
+	e := &fsEntry{header: header}
+	if !header.IsDir && header.Linkname == "" {
+		e.open = open
+	}
+	fsys.entries[name] = e
+	if header.isHardLink() {
+		fsys.links = append(fsys.links, name)
+	}
+	fsys.mkdirs(name)
+}
+
+// mkdirs creates the missing parent directories of name.
+func (fsys *archiveFS) mkdirs(name string) {
+	for _, dir := range parents(name) {
+		if _, ok := fsys.entries[dir]; !ok {
+			fsys.entries[dir] = &fsEntry{header: &Header{Name: dir, IsDir: true, Mode: fs.ModeDir | 0755}}
+		}
+	}
+}
+
+// link resolves hard links and builds the directory listings.
+// Hard links are resolved in archive order, so a link to an earlier link
+// gets the contents of its target. Links to missing targets are dropped.
+func (fsys *archiveFS) link() {
+	var dropped bool
+	for _, name := range fsys.links {
+		e, ok := fsys.entries[name]
+		if !ok || !e.header.isHardLink() {
+			continue
+		}
+		target, ok := fsys.entries[path.Clean(e.header.Linkname)]
+		if !ok || target.open == nil {
+			delete(fsys.entries, name)
+			dropped = true
+			continue
+		}
+		header := *target.header
+		header.Name = e.header.Name
+		e.header, e.open = &header, target.open
+	}
+	if dropped {
+		// A dropped link may have been the parent of other entries.
+		for name := range fsys.entries {
+			fsys.mkdirs(name)
+		}
+	}
+
+	for name, e := range fsys.entries {
+		if name == "." {
+			continue
+		}
+		dir := fsys.entries[path.Dir(name)]
+		if dir == nil {
+			continue
+		}
+		dir.children = append(dir.children, fs.FileInfoToDirEntry(e.header.FileInfo()))
+	}
+	for _, e := range fsys.entries {
+		slices.SortFunc(e.children, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	}
+}
+
+// lookup returns the entry of name. Symbolic links are followed,
+// except for the last element of name if follow is false.
+func (fsys *archiveFS) lookup(op, name string, follow bool) (*fsEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	var links int
+	elems, dir := strings.Split(name, "/"), "."
+	for i := 0; i < len(elems); i++ {
+		cur := path.Join(dir, elems[i])
+		e, ok := fsys.entries[cur]
+		switch {
+		case !ok:
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		case e.header.isSymlink() && (follow || i < len(elems)-1):
+			if links++; links > maxSymlinks {
+				return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of symbolic links")}
+			}
+			target := path.Join(dir, e.header.Linkname)
+			if path.IsAbs(e.header.Linkname) || !fs.ValidPath(target) {
+				return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+			}
+			elems, dir, i = append(strings.Split(target, "/"), elems[i+1:]...), ".", -1
+		case i < len(elems)-1 && !e.header.IsDir:
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		default:
+			dir = cur
+		}
+	}
+
+	return fsys.entries[dir], nil
+}
+
+// Open opens the named file.
+func (fsys *archiveFS) Open(name string) (fs.File, error) {
+	e, err := fsys.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if e.header.IsDir {
+		return &fsDir{e: e, info: e.info(name)}, nil
+	}
+
+	return &fsFile{e: e, info: e.info(name)}, nil
+}
+
+// ReadDir reads the named directory.
+func (fsys *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	e, err := fsys.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !e.header.IsDir {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	return slices.Clone(e.children), nil
+}
+
+// Stat returns a FileInfo describing the named file.
+func (fsys *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	e, err := fsys.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.info(name), nil
+}
+
+// Lstat returns a FileInfo describing the named file without following
+// a symbolic link.
+func (fsys *archiveFS) Lstat(name string) (fs.FileInfo, error) {
+	e, err := fsys.lookup("lstat", name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.info(name), nil
+}
+
+// ReadLink returns the destination of the named symbolic link.
+func (fsys *archiveFS) ReadLink(name string) (string, error) {
+	e, err := fsys.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if !e.header.isSymlink() {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return e.header.Linkname, nil
+}
+
+// info returns the FileInfo of e, named after the last element of name.
+func (e *fsEntry) info(name string) fs.FileInfo {
+	if path.Base(name) == path.Base(e.header.Name) {
+		return e.header.FileInfo()
+	}
+	header := *e.header
+	header.Name = name
+
+	return header.FileInfo()
+}
+
+// FileInfo returns an fs.FileInfo for the Header.
+// Its Sys method returns the *Header.
+func (h *Header) FileInfo() fs.FileInfo {
+	return headerFileInfo{h}
+}
+
+type headerFileInfo struct {
+	h *Header
+}
+
+func (fi headerFileInfo) Name() string {
+	name := strings.TrimSuffix(fi.h.Name, "/")
+	if name == "" {
+		return "."
+	}
+
+	return path.Base(name)
+}
+
+func (fi headerFileInfo) Size() int64 {
+	if fi.h.IsDir || fi.h.Size < 0 {
+		return 0
+	}
+
+	return fi.h.Size
+}
+
+func (fi headerFileInfo) Mode() fs.FileMode {
+	if fi.h.IsDir {
+		return fi.h.Mode | fs.ModeDir
+	}
+
+	return fi.h.Mode
+}
+
+func (fi headerFileInfo) ModTime() time.Time { return fi.h.ModTime }
+func (fi headerFileInfo) IsDir() bool        { return fi.h.IsDir }
+func (fi headerFileInfo) Sys() interface{}   { return fi.h }
+
+// fsFile is a regular file of an archiveFS. The entry is opened lazily,
+// and reopened when seeking backwards.
+type fsFile struct {
+	e      *fsEntry
+	info   fs.FileInfo
+	rc     io.ReadCloser
+	pos    int64 // position of rc
+	offset int64 // position of the next Read
+	closed bool
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *fsFile) Read(b []byte) (int, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+
+	if f.rc == nil || f.offset < f.pos {
+		if f.rc != nil {
+			f.rc.Close()
+			f.rc = nil
+		}
+		rc, err := f.e.open()
+		if err != nil {
+			return 0, err
+		}
+		f.rc, f.pos = rc, 0
+	}
+	if f.offset > f.pos {
+		n, err := io.CopyN(io.Discard, f.rc, f.offset-f.pos)
+		f.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.rc.Read(b)
+	f.pos += int64(n)
+	f.offset = f.pos
+
+	return n, err
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.e.header.Size
+	default:
+		return 0, errors.New("archive: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("archive: negative position")
+	}
+	f.offset = offset
+
+	return offset, nil
+}
+
+func (f *fsFile) Close() error {
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	if f.rc != nil {
+		return f.rc.Close()
+	}
+
+	return nil
+}
+
+// fsDir is a directory of an archiveFS.
+type fsDir struct {
+	e      *fsEntry
+	info   fs.FileInfo
+	offset int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.e.children[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		entries = entries[:min(n, len(entries))]
+	}
+	d.offset += len(entries)
+
+	return slices.Clone(entries), nil
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
@@ -0,0 +1,207 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"text/template"
+	"time"
+)
+
+func TestOpenFS(t *testing.T) {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tree := []File{
+		{Name: "a.txt", Body: []byte("a"), Mode: 0644, ModTime: modTime},
+		{Name: "dir/", IsDir: true, Mode: 0755, ModTime: modTime},
+		{Name: "dir/b.txt", Body: []byte("{{.}}"), Mode: 0600, ModTime: modTime},
+		{Name: "implied/c.txt", Body: []byte("c"), Mode: 0644, ModTime: modTime},
+		{Name: "link", Linkname: "dir/b.txt", Mode: fs.ModeSymlink | 0777, ModTime: modTime},
+		{Name: "dirlink", Linkname: "dir", Mode: fs.ModeSymlink | 0777, ModTime: modTime},
+		{Name: "../evil.txt", Body: []byte("evil"), Mode: 0644, ModTime: modTime},
+	}
+	for _, format := range []Format{ZIP, TAR, PlainTAR, TARXZ, TARZST} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, format, tree...); err != nil {
+			t.Fatal(err)
+		}
+
+		fsys, err := OpenFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt", "implied/c.txt", "link"); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+
+		if _, err := fs.Stat(fsys, "evil.txt"); err == nil {
+			t.Errorf("%s: expected error; got nil", format)
+		}
+		for _, name := range []string{"link", "dirlink/b.txt"} {
+			if b, err := fs.ReadFile(fsys, name); err != nil || string(b) != "{{.}}" {
+				t.Errorf("%s: expected %q; got %q, %v", format, "{{.}}", b, err)
+			}
+		}
+		info, err := fs.Stat(fsys, "dir/b.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != 0600 || !info.ModTime().Equal(modTime) {
+			t.Errorf("%s: expected %v %v; got %v %v", format, fs.FileMode(0600), modTime, info.Mode(), info.ModTime())
+		}
+
+		tmpl, err := template.ParseFS(fsys, "dir/*.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, "ok"); err != nil || out.String() != "ok" {
+			t.Errorf("%s: expected %q; got %q, %v", format, "ok", out.String(), err)
+		}
+	}
+}
+
+func TestOpenFSHTTP(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, TAR, File{Name: "index.txt", Body: []byte("hello, world")}); err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := OpenFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(http.FileServerFS(fsys))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/index.txt", nil)
+	req.Header.Set("Range", "bytes=7-")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusPartialContent || string(b) != "world" {
+		t.Errorf("expected %d %q; got %d %q", http.StatusPartialContent, "world", resp.StatusCode, b)
+	}
+}
+
+type countReaderAt struct {
+	io.ReaderAt
+	n int
+}
+
+func (r *countReaderAt) ReadAt(b []byte, off int64) (int, error) {
+	r.n++
+	return r.ReaderAt.ReadAt(b, off)
+}
+
+func TestOpenFSSpool(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, TAR,
+		File{Name: "a.txt", Body: []byte("a")},
+		File{Name: "dir/b.txt", Body: []byte("b")},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &countReaderAt{ReaderAt: bytes.NewReader(buf.Bytes())}
+	fsys, err := OpenFS(r, int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Entries are read from the spool, without decompressing again.
+	r.n = 0
+	for range 2 {
+		for _, name := range []string{"a.txt", "dir/b.txt"} {
+			if _, err := fs.ReadFile(fsys, name); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if r.n != 0 {
+		t.Errorf("expected no read of the archive; got %d", r.n)
+	}
+
+	if err := fsys.(io.Closer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.ReadFile(fsys, "a.txt"); err == nil {
+		t.Error("expected error after close; got nil")
+	}
+}
+
+func TestOpenFSLimits(t *testing.T) {
+	files := []File{
+		{Name: "a", Body: make([]byte, 1<<20)},
+		{Name: "b", Body: []byte("b")},
+	}
+	tc := []struct {
+		unpacker Unpacker
+		exceeded bool
+	}{
+		{Unpacker{}, false},
+		{Unpacker{MaxEntries: 2, MaxEntrySize: 1 << 20, MaxTotalSize: 1<<20 + 1, MaxRatio: 10000}, false},
+		{Unpacker{MaxEntries: 1}, true},
+		{Unpacker{MaxEntrySize: 1<<20 - 1}, true},
+		{Unpacker{MaxTotalSize: 1 << 20}, true},
+		{Unpacker{MaxRatio: 10}, true},
+	}
+	for _, format := range []Format{ZIP, TAR} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, format, files...); err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range tc {
+			fsys, err := i.unpacker.OpenFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if exceeded := errors.Is(err, ErrLimitExceeded); exceeded != i.exceeded {
+				t.Errorf("%s %+v: expected exceeded %v; got %v", format, i.unpacker, i.exceeded, err)
+			}
+			if err == nil {
+				fsys.(io.Closer).Close()
+			}
+		}
+	}
+}
+
+func TestOpenFSHardLinks(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, TAR,
+		File{Name: "f", Body: []byte("f"), Mode: 0644},
+		File{Name: "h1", Linkname: "f", Mode: 0644},
+		File{Name: "h2", Linkname: "h1", Mode: 0644},
+		File{Name: "x/y", Body: []byte("y"), Mode: 0644},
+		File{Name: "x", Linkname: "missing", Mode: 0644},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// Resolution must not depend on the map iteration order.
+	for range 20 {
+		fsys, err := OpenFS(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range []string{"h1", "h2"} {
+			if b, err := fs.ReadFile(fsys, name); err != nil || string(b) != "f" {
+				t.Errorf("%s: expected %q; got %q, %v", name, "f", b, err)
+			}
+		}
+		if b, err := fs.ReadFile(fsys, "x/y"); err != nil || string(b) != "y" {
+			t.Errorf("expected %q; got %q, %v", "y", b, err)
+		}
+		if info, err := fs.Stat(fsys, "x"); err != nil || !info.IsDir() {
+			t.Errorf("expected x to be a directory; got %v, %v", info, err)
+		}
+		if err := fstest.TestFS(fsys, "f", "h1", "h2", "x/y"); err != nil {
+			t.Error(err)
+		}
+		fsys.(io.Closer).Close()
+	}
+}
@@ -0,0 +1,152 @@
+package archive
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// pattern is a compiled gitignore-style pattern.
+type pattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// matcher matches slash-separated paths against gitignore-style patterns.
+// Later patterns take precedence over earlier ones.
+type matcher struct {
+	patterns []*pattern
+}
+
+// add adds the pattern p, which is relative to the directory base.
+//
+// The syntax follows .gitignore: a leading "!" negates the pattern,
+// a trailing "/" matches directories only, a pattern containing "/"
+// is anchored to base while others match at any depth, "*" and "?"
+// do not match "/", and "**" matches any number of directories.
+func (m *matcher) add(base, p string) error {
+	p = strings.TrimRight(p, " ")
+	if p == "" || strings.HasPrefix(p, "#") {
+		return nil
+	}
+
+	var pt pattern
+	if strings.HasPrefix(p, "!") {
+		pt.negate = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, `\`) {
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		pt.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	if p == "" {
+		return nil
+	}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	if base != "" && base != "." {
+		expr.WriteString(regexp.QuoteMeta(base + "/"))
+	}
+	if strings.Contains(p, "/") {
+		p = strings.TrimPrefix(p, "/")
+	} else {
+		expr.WriteString("(?:.*/)?")
+	}
+	expr.WriteString(globExpr(p))
+	expr.WriteString("$")
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return err
+	}
+	pt.re = re
+	m.patterns = append(m.patterns, &pt)
+
+	return nil
+}
+
+// read adds the patterns read from r, one per line.
+func (m *matcher) read(base string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if err := m.add(base, scanner.Text()); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+// match reports whether name is matched by the patterns.
+func (m *matcher) match(name string, isDir bool) (matched bool) {
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(name) {
+			matched = !p.negate
+		}
+	}
+
+	return
+}
+
+func globExpr(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				switch rest := glob[i+2:]; {
+				case strings.HasPrefix(rest, "/"):
+					expr.WriteString("(?:.*/)?")
+					i += 2
+				default:
+					expr.WriteString(".*")
+					i++
+				}
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+			}
+			expr.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return expr.String()
+}
+
+// parents returns the parent directories of the slash-separated name,
+// from the outermost to the innermost.
+func parents(name string) (dirs []string) {
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	return
+}
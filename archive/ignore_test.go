@@ -0,0 +1,51 @@
+package archive
+
+import "testing"
+
+func TestMatcher(t *testing.T) {
+	var m matcher
+	for _, p := range []string{
+		"# comment",
+		"*.log",
+		"!keep.log",
+		"/root.txt",
+		"build/",
+		"docs/**/*.md",
+		"a?c",
+		"[xy].txt",
+	} {
+		if err := m.add("", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.add("sub", "/local"); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		name    string
+		isDir   bool
+		matched bool
+	}{
+		{"x.log", false, true},
+		{"dir/x.log", false, true},
+		{"keep.log", false, false},
+		{"root.txt", false, true},
+		{"dir/root.txt", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"docs/a.md", false, true},
+		{"docs/a/b/c.md", false, true},
+		{"abc", false, true},
+		{"abbc", false, false},
+		{"x.txt", false, true},
+		{"z.txt", false, false},
+		{"sub/local", false, true},
+		{"local", false, false},
+	}
+	for _, i := range tc {
+		if matched := m.match(i.name, i.isDir); matched != i.matched {
+			t.Errorf("%q: expected %v; got %v", i.name, i.matched, matched)
+		}
+	}
+}
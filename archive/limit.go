@@ -0,0 +1,155 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrLimitExceeded is returned when an archive exceeds one of the limits
+// set in Unpacker.
+var ErrLimitExceeded = errors.New("archive: limit exceeded")
+
+// limitReader enforces the limits of an Unpacker while entries are read.
+type limitReader struct {
+	Reader
+	u          *Unpacker
+	compressed func() int64
+
+	entries   int
+	entrySize int64
+	total     int64
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	r.n += int64(n)
+
+	return n, err
+}
+
+func (u *Unpacker) limited() bool {
+	return u.MaxEntries > 0 || u.MaxEntrySize > 0 || u.MaxTotalSize > 0 || u.MaxRatio > 0
+}
+
+// limit wraps r to count the compressed bytes read, if needed,
+// and returns a function wrapping the Reader to enforce the limits of u.
+func (u *Unpacker) limit(r io.Reader) (io.Reader, func(Reader) Reader) {
+	if !u.limited() {
+		return r, func(ar Reader) Reader { return ar }
+	}
+
+	var compressed func() int64
+	if _, size, ok := sizeReaderAt(r); ok {
+		compressed = func() int64 { return size }
+	} else {
+		cr := &countReader{r: r}
+		r, compressed = cr, func() int64 { return cr.n }
+	}
+
+	return r, func(ar Reader) Reader {
+		lr := &limitReader{Reader: ar, u: u, compressed: compressed}
+		if s, ok := ar.(skipper); ok {
+			s.countSkipped(lr.skip)
+		}
+		return lr
+	}
+}
+
+// skipper is implemented by the Readers skipping unsupported entries,
+// so that these entries are counted against the limits too.
+type skipper interface {
+	countSkipped(func(*Header) error)
+}
+
+// skip counts an entry skipped by the underlying Reader.
+func (r *limitReader) skip(header *Header) error {
+	r.entries++
+
+	return r.u.checkHeader(r.entries, header)
+}
+
+func (r *limitReader) Next() (*Header, error) {
+	header, err := r.Reader.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	r.entries++
+	if err := r.u.checkHeader(r.entries, header); err != nil {
+		return nil, err
+	}
+	r.entrySize = 0
+
+	return header, nil
+}
+
+// checkHeader checks the n-th entry header against the limits of u.
+func (u *Unpacker) checkHeader(n int, header *Header) error {
+	if u.MaxEntries > 0 && n > u.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, u.MaxEntries)
+	}
+	if u.MaxEntrySize > 0 && header.Size > u.MaxEntrySize {
+		return fmt.Errorf("%w: entry %q is larger than %d bytes", ErrLimitExceeded, header.Name, u.MaxEntrySize)
+	}
+
+	return nil
+}
+
+func (r *limitReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.entrySize += int64(n)
+	r.total += int64(n)
+
+	if r.u.MaxEntrySize > 0 && r.entrySize > r.u.MaxEntrySize {
+		return n, fmt.Errorf("%w: entry is larger than %d bytes", ErrLimitExceeded, r.u.MaxEntrySize)
+	}
+	if err := r.u.checkTotal(r.total, r.compressed()); err != nil {
+		return n, err
+	}
+
+	return n, err
+}
+
+// checkTotal checks the uncompressed size of the entries read so far
+// against the limits of u, given the compressed size read.
+func (u *Unpacker) checkTotal(total, compressed int64) error {
+	switch {
+	case u.MaxTotalSize > 0 && total > u.MaxTotalSize:
+		return fmt.Errorf("%w: archive is larger than %d bytes", ErrLimitExceeded, u.MaxTotalSize)
+	case u.MaxRatio > 0 && float64(total) > u.MaxRatio*float64(max(compressed, 1)):
+		return fmt.Errorf("%w: compression ratio is higher than %g", ErrLimitExceeded, u.MaxRatio)
+	}
+
+	return nil
+}
+
+// entryLimitReader enforces the entry size limit of an Unpacker
+// on the contents of a single entry.
+type entryLimitReader struct {
+	io.ReadCloser
+	max, n int64
+}
+
+// limitEntry wraps rc to enforce the entry size limit of u, if any.
+func (u *Unpacker) limitEntry(rc io.ReadCloser) io.ReadCloser {
+	if u.MaxEntrySize <= 0 {
+		return rc
+	}
+
+	return &entryLimitReader{ReadCloser: rc, max: u.MaxEntrySize}
+}
+
+func (r *entryLimitReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	if r.n += int64(n); r.n > r.max {
+		return n, fmt.Errorf("%w: entry is larger than %d bytes", ErrLimitExceeded, r.max)
+	}
+
+	return n, err
+}
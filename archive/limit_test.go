@@ -0,0 +1,79 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestUnpackLimits(t *testing.T) {
+	files := []File{
+		{Name: "a", Body: make([]byte, 1<<20)},
+		{Name: "b", Body: []byte("b")},
+	}
+	tc := []struct {
+		unpacker Unpacker
+		exceeded bool
+	}{
+		{Unpacker{}, false},
+		{Unpacker{MaxEntries: 2, MaxEntrySize: 1 << 20, MaxTotalSize: 1<<20 + 1, MaxRatio: 10000}, false},
+		{Unpacker{MaxEntries: 1}, true},
+		{Unpacker{MaxEntrySize: 1<<20 - 1}, true},
+		{Unpacker{MaxTotalSize: 1 << 20}, true},
+		{Unpacker{MaxRatio: 10}, true},
+	}
+	for _, format := range []Format{ZIP, TAR} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, format, files...); err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range tc {
+			for _, r := range []io.Reader{
+				bytes.NewReader(buf.Bytes()),
+				struct{ io.Reader }{bytes.NewReader(buf.Bytes())},
+			} {
+				_, err := i.unpacker.Unpack(r)
+				if exceeded := errors.Is(err, ErrLimitExceeded); exceeded != i.exceeded {
+					t.Errorf("%d %+v: expected exceeded %v; got %v", format, i.unpacker, i.exceeded, err)
+				}
+			}
+		}
+	}
+}
+
+func TestUnpackLimitsSkipped(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for i := range 1000 {
+		if err := tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("fifo%d", i), Typeflag: tar.TypeFifo}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	u := Unpacker{MaxEntries: 10, OnEvent: func(e Event) {
+		if e.Type == EntrySkipped {
+			n++
+		}
+	}}
+	if _, err := u.Unpack(bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("expected exceeded; got %v", err)
+	}
+	if n > u.MaxEntries {
+		t.Errorf("expected at most %d skipped entries; got %d", u.MaxEntries, n)
+	}
+	if _, err := u.OpenFS(bytes.NewReader(buf.Bytes()), int64(buf.Len())); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("OpenFS: expected exceeded; got %v", err)
+	}
+}
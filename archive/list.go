@@ -0,0 +1,68 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+)
+
+// List returns the headers of all entries in the archive read from r,
+// without extracting their contents.
+func List(r io.Reader) ([]Header, error) {
+	return defaultUnpacker.List(r)
+}
+
+// Test reads every entry in the archive read from r, discarding the contents,
+// and returns the first checksum or structural error found.
+func Test(r io.Reader) error {
+	return defaultUnpacker.Test(r)
+}
+
+// List returns the headers of all entries in the archive read from r
+// like List, using the options of u.
+func (u *Unpacker) List(r io.Reader) ([]Header, error) {
+	ar, err := u.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer ar.Close()
+
+	var headers []Header
+	for {
+		header, err := ar.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		headers = append(headers, *header)
+	}
+
+	return headers, nil
+}
+
+// Test reads every entry in the archive read from r like Test,
+// using the options of u.
+func (u *Unpacker) Test(r io.Reader) error {
+	ar, err := u.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	for {
+		header, err := ar.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		n, err := io.Copy(io.Discard, ar)
+		if err != nil {
+			return fmt.Errorf("archive: testing %q: %w", header.Name, err)
+		}
+		if header.Size >= 0 && n != header.Size {
+			return fmt.Errorf("archive: testing %q: read %d bytes; expected %d", header.Name, n, header.Size)
+		}
+	}
+}
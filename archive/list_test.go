@@ -0,0 +1,82 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"hash/crc32"
+	"os"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	for _, i := range []struct {
+		name       string
+		compressed int64
+		crc        uint32
+	}{
+		{"testdata/test.zip", 1, crc32.ChecksumIEEE([]byte("1"))},
+		{"testdata/test.tar", 1, 0},
+		{"testdata/test.tar.gz", -1, 0},
+	} {
+		f, err := os.Open(i.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers, err := List(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(headers) != 2 {
+			t.Fatalf("%s: expected 2 headers; got %d", i.name, len(headers))
+		}
+		h := headers[0]
+		if h.Name != "1.txt" || h.Size != 1 || h.CompressedSize != i.compressed || h.CRC32 != i.crc || h.ModTime.IsZero() {
+			t.Errorf("%s: unexpected header %#v", i.name, h)
+		}
+	}
+
+	// Listing an encrypted archive does not need the password.
+	f, err := os.Open("testdata/crypto.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := List(f); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTest(t *testing.T) {
+	for _, format := range []Format{ZIP, TAR, PlainTAR, TARXZ, TARZST} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, format, files...); err != nil {
+			t.Fatal(err)
+		}
+		if err := Test(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Errorf("%s: %v", format, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Pack(&buf, ZIP, File{Name: "a.txt", Body: []byte("hello")}); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	b[bytes.Index(b, []byte("hello"))] = 'j'
+	if err := Test(bytes.NewReader(b)); err == nil {
+		t.Error("zip: expected error; got nil")
+	}
+
+	buf.Reset()
+	if err := Pack(&buf, TAR, files...); err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the CRC-32 in the gzip trailer.
+	b = buf.Bytes()
+	b[len(b)-8] ^= 0xff
+	if err := Test(bytes.NewReader(b)); !errors.Is(err, gzip.ErrChecksum) {
+		t.Errorf("tar.gz: expected %v; got %v", gzip.ErrChecksum, err)
+	}
+}
@@ -0,0 +1,48 @@
+package archive
+
+import (
+	"io/fs"
+	"os"
+)
+
+// OverwritePolicy decides how UnpackToFiles handles entries
+// whose path already exists in the destination directory.
+// Existing directories are always merged.
+type OverwritePolicy int
+
+const (
+	// OverwriteExisting replaces existing files.
+	OverwriteExisting OverwritePolicy = iota
+	// SkipExisting keeps existing files and skips the entries.
+	SkipExisting
+	// FailExisting aborts the extraction with an error wrapping fs.ErrExist.
+	FailExisting
+	// KeepNewerExisting keeps existing files that are newer than the entries.
+	KeepNewerExisting
+)
+
+// skip reports whether the entry of header is to be skipped
+// because path exists.
+func (p OverwritePolicy) skip(path string, header *Header) (bool, error) {
+	if p == OverwriteExisting {
+		return false, nil
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	switch p {
+	case SkipExisting:
+		return true, nil
+	case FailExisting:
+		return false, &fs.PathError{Op: "unpack", Path: path, Err: fs.ErrExist}
+	case KeepNewerExisting:
+		return info.ModTime().After(header.ModTime), nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,154 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOverwritePolicy(t *testing.T) {
+	modTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	if err := Pack(&buf, TAR,
+		File{Name: "old.txt", Body: []byte("archive"), ModTime: modTime},
+		File{Name: "new.txt", Body: []byte("archive"), ModTime: modTime},
+		File{Name: "added.txt", Body: []byte("archive"), ModTime: modTime},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		policy        OverwritePolicy
+		old, new      string
+		expectedError bool
+	}{
+		{OverwriteExisting, "archive", "archive", false},
+		{SkipExisting, "existing", "existing", false},
+		{FailExisting, "existing", "existing", true},
+		{KeepNewerExisting, "archive", "existing", false},
+	}
+	for _, i := range tc {
+		for _, atomic := range []bool{false, true} {
+			dest := t.TempDir()
+			for name, mtime := range map[string]time.Time{
+				"old.txt": modTime.Add(-time.Hour),
+				"new.txt": modTime.Add(time.Hour),
+			} {
+				path := filepath.Join(dest, name)
+				if err := os.WriteFile(path, []byte("existing"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chtimes(path, time.Time{}, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := (&Unpacker{Overwrite: i.policy, Atomic: atomic}).UnpackToFiles(bytes.NewReader(buf.Bytes()), dest)
+			if i.expectedError {
+				if !errors.Is(err, fs.ErrExist) {
+					t.Errorf("policy %d: expected ErrExist; got %v", i.policy, err)
+				}
+				continue
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			for name, expected := range map[string]string{"old.txt": i.old, "new.txt": i.new, "added.txt": "archive"} {
+				if b, _ := os.ReadFile(filepath.Join(dest, name)); string(b) != expected {
+					t.Errorf("policy %d, atomic %v: expected %s %q; got %q", i.policy, atomic, name, expected, b)
+				}
+			}
+		}
+	}
+}
+
+func TestUnpackToFilesAtomic(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, TAR,
+		File{Name: "dir/a.txt", Body: []byte("a")},
+		File{Name: "../evil.txt", Body: []byte("evil")},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := t.TempDir()
+	dest := filepath.Join(parent, "dest")
+	u := &Unpacker{Atomic: true}
+	if err := u.UnpackToFiles(bytes.NewReader(buf.Bytes()), dest); err == nil {
+		t.Fatal("expected error; got nil")
+	}
+	if entries, _ := os.ReadDir(parent); len(entries) != 0 {
+		t.Errorf("expected nothing left behind; got %v", entries)
+	}
+
+	buf.Reset()
+	if err := Pack(&buf, TAR, File{Name: "dir/a.txt", Body: []byte("a")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.UnpackToFiles(bytes.NewReader(buf.Bytes()), dest); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dest); err != nil || info.Mode().Perm()&0055 == 0 {
+		t.Errorf("expected accessible directory; got %v, %v", info, err)
+	}
+
+	// Existing destinations are merged into.
+	if err := os.WriteFile(filepath.Join(dest, "dir/b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.UnpackToFiles(bytes.NewReader(buf.Bytes()), dest); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dir/a.txt", "dir/b.txt"} {
+		if _, err := os.Stat(filepath.Join(dest, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	if entries, _ := os.ReadDir(parent); len(entries) != 1 {
+		t.Errorf("expected only dest; got %v", entries)
+	}
+}
+
+func TestUnpackToFilesAtomicConflict(t *testing.T) {
+	for _, i := range []struct {
+		existing func(dest string) error
+		file     string
+	}{
+		// A file would replace a directory.
+		{func(dest string) error { return os.Mkdir(filepath.Join(dest, "a"), 0755) }, "a"},
+		// A directory would replace a file.
+		{func(dest string) error { return os.WriteFile(filepath.Join(dest, "a"), []byte("old"), 0644) }, "a/b.txt"},
+	} {
+		parent := t.TempDir()
+		dest := filepath.Join(parent, "dest")
+		if err := os.Mkdir(dest, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dest, "0.txt"), []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := i.existing(dest); err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := Pack(&buf, TAR,
+			File{Name: "0.txt", Body: []byte("new")},
+			File{Name: i.file, Body: []byte("new")},
+		); err != nil {
+			t.Fatal(err)
+		}
+		if err := (&Unpacker{Atomic: true}).UnpackToFiles(&buf, dest); err == nil {
+			t.Errorf("%s: expected error; got nil", i.file)
+		}
+		if b, _ := os.ReadFile(filepath.Join(dest, "0.txt")); string(b) != "old" {
+			t.Errorf("%s: expected dest untouched; got 0.txt %q", i.file, b)
+		}
+		if entries, _ := os.ReadDir(parent); len(entries) != 1 {
+			t.Errorf("%s: expected only dest; got %v", i.file, entries)
+		}
+	}
+}
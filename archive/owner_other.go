@@ -0,0 +1,9 @@
+//go:build !unix
+
+package archive
+
+import "io/fs"
+
+func fileOwner(fs.FileInfo) (uid, gid int) { return }
+
+func restoreOwner(string, *Header) error { return nil }
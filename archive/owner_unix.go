@@ -0,0 +1,34 @@
+//go:build unix
+
+package archive
+
+import (
+	"io/fs"
+	"os"
+	"syscall"
+)
+
+func fileOwner(info fs.FileInfo) (uid, gid int) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return int(stat.Uid), int(stat.Gid)
+	}
+
+	return
+}
+
+// restoreOwner restores the ownership and the exact mode of path,
+// including the setuid, setgid and sticky bits, if running as root.
+func restoreOwner(path string, header *Header) error {
+	if os.Geteuid() != 0 {
+		return nil
+	}
+
+	if err := os.Lchown(path, header.Uid, header.Gid); err != nil {
+		return err
+	}
+	if header.isSymlink() || header.Mode == 0 {
+		return nil
+	}
+
+	return os.Chmod(path, header.Mode)
+}
@@ -1,27 +1,191 @@
 package archive
 
 import (
-	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
 )
 
+// Packer holds the options used to pack archives.
+// The zero value is ready to use.
+type Packer struct {
+	// Level is the gzip or deflate compression level, from 1 (best speed)
+	// to 9 (best compression). Zero means the default level.
+	Level int
+	// StoreIncompressible stores ZIP entries whose method is DefaultMethod
+	// without compression if they look incompressible, judging from
+	// their file extension or from compressing their first bytes.
+	StoreIncompressible bool
+	// Password encrypts the files of ZIP archives with WinZip AES,
+	// with the strength set by Encryption. Other formats return an error.
+	Password   string
+	Encryption Encryption
+	// Charset, if not nil, encodes the names of ZIP entries with a legacy
+	// charset, like simplifiedchinese.GBK, for tools that do not support
+	// UTF-8 names. The UTF-8 names are also stored in Info-ZIP Unicode Path
+	// extra fields. Names the charset cannot represent are stored in UTF-8.
+	// By default, names are stored in UTF-8 with the UTF-8 flag set.
+	Charset encoding.Encoding
+	// Concurrency, if greater than 1, compresses tar.gz archives with that
+	// many goroutines. The input is split into blocks compressed into
+	// separate gzip members, like pigz does, which any gzip reader reads
+	// as a single stream.
+	Concurrency int
+
+	// Prefix is prepended to the name of every entry packed from a directory.
+	Prefix string
+	// Include, if not empty, limits the packed files to those matching
+	// at least one pattern, or inside a directory that does.
+	// Exclude skips the files and directories matching any pattern.
+	// Patterns use the .gitignore syntax and are matched against
+	// slash-separated paths relative to the packed directory.
+	Include, Exclude []string
+	// IgnoreFile is the name of the .gitignore-style files, e.g. ".gitignore",
+	// whose patterns exclude files in the directory containing them and below.
+	IgnoreFile string
+	// FollowSymlinks packs the targets of symbolic links instead of the links.
+	FollowSymlinks bool
+
+	// Deterministic makes the output depend only on the names, types and
+	// contents of the entries, so that packing the same files produces
+	// identical bytes. Entries passed to Pack and PackFromFiles are sorted
+	// by name, ownership is cleared, and modes are set to 0755 for directories
+	// and executable files and to 0644 for other files. The modification
+	// times are set to ModTime, or to SOURCE_DATE_EPOCH if ModTime is zero
+	// and the environment variable is set, or else to 1980-01-01 UTC.
+	// Encrypted output is never deterministic.
+	Deterministic bool
+	ModTime       time.Time
+
+	// OnEvent, if not nil, receives the events of the entries written,
+	// and of the files skipped when packing a directory.
+	OnEvent func(Event)
+}
+
+var defaultPacker = &Packer{}
+
 // Pack creates an archive from File struct.
 func Pack(w io.Writer, format Format, files ...File) error {
-	switch format {
-	case ZIP:
-		return packZip(w, files...)
-	case TAR:
-		return packTar(w, files...)
-	default:
-		return errors.New("unknow format")
-	}
+	return defaultPacker.Pack(w, format, files...)
 }
 
 // PackFromFiles creates an archive from files.
+// The contents of each file are streamed into the archive, and its mode,
+// modification time and ownership are preserved. Symbolic links are stored
+// as links.
 func PackFromFiles(w io.Writer, format Format, files ...string) error {
-	fs, err := readFiles(files...)
+	return defaultPacker.PackFromFiles(w, format, files...)
+}
+
+// Pack creates an archive from File struct.
+func (p *Packer) Pack(w io.Writer, format Format, files ...File) error {
+	aw, err := p.NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	if p.Deterministic {
+		files = slices.Clone(files)
+		slices.SortStableFunc(files, func(a, b File) int { return strings.Compare(a.Name, b.Name) })
+	}
+	for _, file := range files {
+		if err := packEntry(aw, file); err != nil {
+			return err
+		}
+	}
+
+	return aw.Close()
+}
+
+func packEntry(aw Writer, file File) error {
+	header := file.header()
+	if err := aw.WriteHeader(header); err != nil {
+		return err
+	}
+	if header.IsDir || header.Linkname != "" {
+		return nil
+	}
+	_, err := aw.Write(file.Body)
+
+	return err
+}
+
+// PackFromFiles creates an archive from files.
+func (p *Packer) PackFromFiles(w io.Writer, format Format, files ...string) error {
+	aw, err := p.NewWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	if p.Deterministic {
+		files = slices.Clone(files)
+		slices.Sort(files)
+	}
+	for _, file := range files {
+		if err := packFile(aw, file); err != nil {
+			return err
+		}
+	}
+
+	return aw.Close()
+}
+
+func packFile(aw Writer, name string) error {
+	info, err := os.Lstat(name)
+	if err != nil {
+		return err
+	}
+
+	header, err := infoHeader(name, info)
+	if err != nil {
+		return err
+	}
+	if header.isSymlink() {
+		if header.Linkname, err = os.Readlink(name); err != nil {
+			return err
+		}
+	}
+	if err := aw.WriteHeader(header); err != nil {
+		return err
+	}
+	if header.IsDir || header.Linkname != "" {
+		return nil
+	}
+
+	f, err := os.Open(name)
 	if err != nil {
 		return err
 	}
-	return Pack(w, format, fs...)
+	defer f.Close()
+
+	_, err = io.Copy(aw, f)
+
+	return err
+}
+
+// infoHeader creates a Header named name from info.
+// The link target of a symbolic link is left to the caller.
+func infoHeader(name string, info fs.FileInfo) (*Header, error) {
+	header := &Header{
+		Name:    name,
+		IsDir:   info.IsDir(),
+		Mode:    info.Mode() & modeMask,
+		ModTime: info.ModTime(),
+	}
+	header.Uid, header.Gid = fileOwner(info)
+
+	switch {
+	case info.Mode().IsRegular():
+		header.Size = info.Size()
+	case !info.IsDir() && info.Mode()&fs.ModeSymlink == 0:
+		return nil, fmt.Errorf("archive: unsupported file type %s: %q", info.Mode().Type(), name)
+	}
+
+	return header, nil
 }
@@ -1,7 +1,11 @@
 package archive
 
 import (
+	"archive/zip"
 	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
 	"testing"
 )
 
@@ -10,9 +14,26 @@ var files = []File{
 	{Name: "testdata/2.txt", Body: []byte("2")},
 }
 
+// statFiles returns files with the metadata of the files on disk.
+func statFiles(t *testing.T) []File {
+	var fs []File
+	for _, f := range files {
+		info, err := os.Stat(f.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Mode = info.Mode()
+		f.ModTime = info.ModTime()
+		f.Uid, f.Gid = fileOwner(info)
+		fs = append(fs, f)
+	}
+
+	return fs
+}
+
 func TestPackZIP(t *testing.T) {
 	var buf1, buf2 bytes.Buffer
-	if err := Pack(&buf1, ZIP, files...); err != nil {
+	if err := Pack(&buf1, ZIP, statFiles(t)...); err != nil {
 		t.Fatal(err)
 	}
 	if err := PackFromFiles(&buf2, ZIP, "testdata/1.txt", "testdata/2.txt"); err != nil {
@@ -41,3 +62,92 @@ func TestPackTAR(t *testing.T) {
 		t.Error("expected equal magic; got not equal")
 	}
 }
+
+func TestPackFormats(t *testing.T) {
+	for _, format := range []Format{PlainTAR, TARXZ, TARZST} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, format, files...); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := Unpack(&buf)
+		if err != nil {
+			t.Fatalf("Unpack format %d failed: %v", format, err)
+		}
+		if len(fs) != len(files) {
+			t.Fatalf("expected %d files; got %d", len(files), len(fs))
+		}
+		for i := range fs {
+			if fs[i].Name != files[i].Name || !bytes.Equal(fs[i].Body, files[i].Body) {
+				t.Errorf("expected %q(%q); got %q(%q)", files[i].Name, files[i].Body, fs[i].Name, fs[i].Body)
+			}
+		}
+	}
+
+	if err := Pack(io.Discard, TARBZ2, files...); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
+
+func TestPackerLevel(t *testing.T) {
+	body := bytes.Repeat([]byte("abcdefghijklmnopqrstuvwxyz0123456789"), 1<<12)
+	for _, format := range []Format{ZIP, TAR} {
+		var fast, best bytes.Buffer
+		if err := (&Packer{Level: 1}).Pack(&fast, format, File{Name: "a", Body: body}); err != nil {
+			t.Fatal(err)
+		}
+		if err := (&Packer{Level: 9}).Pack(&best, format, File{Name: "a", Body: body}); err != nil {
+			t.Fatal(err)
+		}
+		if best.Len() > fast.Len() {
+			t.Errorf("expected best compression no larger than %d; got %d", fast.Len(), best.Len())
+		}
+		fs, err := Unpack(&best)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(fs[0].Body, body) {
+			t.Error("expected equal body; got not equal")
+		}
+	}
+}
+
+func TestPackerMethod(t *testing.T) {
+	random := make([]byte, 100<<10)
+	rand.Read(random)
+	zeros := make([]byte, 100<<10)
+
+	files := []File{
+		{Name: "store", Body: zeros, Method: Store},
+		{Name: "deflate", Body: random, Method: Deflate},
+		{Name: "random", Body: random},
+		{Name: "small", Body: random[:100]},
+		{Name: "zeros", Body: zeros},
+		{Name: "photo.JPG", Body: zeros},
+		{Name: "empty"},
+	}
+	expected := []uint16{zip.Store, zip.Deflate, zip.Store, zip.Store, zip.Deflate, zip.Store, zip.Deflate}
+
+	var buf bytes.Buffer
+	if err := (&Packer{StoreIncompressible: true}).Pack(&buf, ZIP, files...); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range zr.File {
+		if f.Method != expected[i] {
+			t.Errorf("%s: expected method %d; got %d", f.Name, expected[i], f.Method)
+		}
+	}
+
+	fs, err := Unpack(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range fs {
+		if !bytes.Equal(fs[i].Body, files[i].Body) {
+			t.Errorf("%s: expected equal body; got not equal", fs[i].Name)
+		}
+	}
+}
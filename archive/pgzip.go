@@ -0,0 +1,119 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+
+	"github.com/sunshineplan/utils/workers"
+)
+
+// gzipBlockSize is the size of the blocks compressed in parallel.
+const gzipBlockSize = 1 << 20
+
+// parallelGzipWriter compresses blocks of its input in parallel, each into
+// a gzip member of its own. Like the output of pigz, the concatenated members
+// form a gzip stream that any gzip reader decompresses as a whole.
+type parallelGzipWriter struct {
+	w       io.Writer
+	level   int
+	workers *workers.Workers
+
+	blocks [][]byte // full blocks waiting to be compressed
+	block  []byte   // block being filled
+	free   [][]byte
+	out    []bytes.Buffer
+
+	written bool
+	closed  bool
+	err     error
+}
+
+func newParallelGzipWriter(w io.Writer, level, concurrency int) (*parallelGzipWriter, error) {
+	// Validate level once, so that compressing blocks cannot fail.
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		return nil, err
+	}
+
+	return &parallelGzipWriter{
+		w:       w,
+		level:   level,
+		workers: workers.New(concurrency),
+		blocks:  make([][]byte, 0, concurrency),
+		out:     make([]bytes.Buffer, concurrency),
+	}, nil
+}
+
+func (w *parallelGzipWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, fs.ErrClosed
+	} else if w.err != nil {
+		return 0, w.err
+	}
+
+	n := len(b)
+	for len(b) > 0 {
+		if w.block == nil {
+			if len(w.free) > 0 {
+				w.block, w.free = w.free[len(w.free)-1][:0], w.free[:len(w.free)-1]
+			} else {
+				w.block = make([]byte, 0, gzipBlockSize)
+			}
+		}
+
+		k := min(len(b), gzipBlockSize-len(w.block))
+		w.block, b = append(w.block, b[:k]...), b[k:]
+		if len(w.block) == gzipBlockSize {
+			w.blocks, w.block = append(w.blocks, w.block), nil
+			if len(w.blocks) == cap(w.blocks) {
+				if err := w.flush(); err != nil {
+					return n - len(b), err
+				}
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// flush compresses the full blocks in parallel and writes them in order.
+func (w *parallelGzipWriter) flush() error {
+	if len(w.blocks) == 0 {
+		return nil
+	}
+
+	w.workers.Range(0, len(w.blocks)-1, func(i int) {
+		w.out[i].Reset()
+		zw, _ := gzip.NewWriterLevel(&w.out[i], w.level)
+		zw.Write(w.blocks[i])
+		zw.Close()
+	})
+	for i := range w.blocks {
+		if _, err := w.out[i].WriteTo(w.w); err != nil {
+			w.err = err
+			return err
+		}
+	}
+	w.written = true
+	w.free, w.blocks = append(w.free, w.blocks...), w.blocks[:0]
+
+	return nil
+}
+
+// Close compresses the remaining input. It does not close the underlying writer.
+func (w *parallelGzipWriter) Close() error {
+	if w.closed {
+		return nil
+	} else if w.err != nil {
+		return w.err
+	}
+	w.closed = true
+
+	// An empty input still needs one gzip member.
+	if len(w.block) > 0 || !w.written && len(w.blocks) == 0 {
+		w.blocks, w.block = append(w.blocks, w.block), nil
+	}
+
+	return w.flush()
+}
@@ -0,0 +1,65 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestParallelGzip(t *testing.T) {
+	var data bytes.Buffer
+	for i := 0; data.Len() < 5*gzipBlockSize+123; i++ {
+		fmt.Fprintf(&data, "line %d\n", i)
+	}
+
+	var buf bytes.Buffer
+	p := &Packer{Concurrency: 4}
+	if err := p.Pack(&buf, TAR, File{Name: "data.txt", Body: data.Bytes()}, File{Name: "empty.txt"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := Unpack(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fs) != 2 || !bytes.Equal(fs[0].Body, data.Bytes()) {
+		t.Error("unexpected unpacked contents")
+	}
+
+	// The output has one gzip member per block.
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var members int
+	for {
+		zr.Multistream(false)
+		if _, err := io.Copy(io.Discard, zr); err != nil {
+			t.Fatal(err)
+		}
+		members++
+		if err := zr.Reset(&buf); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if members != 6 {
+		t.Errorf("expected 6 members; got %d", members)
+	}
+
+	// Empty input is still a valid gzip stream.
+	buf.Reset()
+	w, err := newParallelGzipWriter(&buf, gzip.DefaultCompression, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gzip.NewReader(&buf); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,192 @@
+package archive
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PathPolicy decides how entries whose path would escape
+// the destination directory are handled.
+type PathPolicy int
+
+const (
+	// RejectUnsafe aborts the extraction with a *PathError.
+	RejectUnsafe PathPolicy = iota
+	// StripUnsafe removes the volume name, leading slashes and ".." elements
+	// from the path, e.g. "../../etc/x" becomes "etc/x" and "a/../../b" becomes "a/b".
+	StripUnsafe
+	// RewriteUnsafe resolves the path as if the destination directory were
+	// the root directory, e.g. "../../etc/x" becomes "etc/x" and "a/../../b" becomes "b".
+	RewriteUnsafe
+)
+
+// PathError records an archive entry whose path is unsafe to extract.
+type PathError struct {
+	Name   string
+	Reason string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("archive: unsafe path %q: %s", e.Name, e.Reason)
+}
+
+// sanitize returns name as a path relative to the destination directory.
+func (p PathPolicy) sanitize(name string) (string, error) {
+	if local(name) {
+		return path.Clean(name), nil
+	}
+
+	var rel string
+	switch p {
+	case StripUnsafe:
+		var elems []string
+		for _, elem := range strings.Split(trimVolume(name), "/") {
+			if elem != "" && elem != "." && elem != ".." {
+				elems = append(elems, elem)
+			}
+		}
+		rel = path.Join(elems...)
+	case RewriteUnsafe:
+		rel = strings.TrimPrefix(path.Join("/", trimVolume(name)), "/")
+	default:
+		return "", &PathError{name, "path escapes destination"}
+	}
+
+	if rel == "" || !local(rel) {
+		return "", &PathError{name, "path escapes destination"}
+	}
+
+	return rel, nil
+}
+
+// sanitizeLink returns the target of the link named name, which must already
+// be sanitized, so that it resolves inside the destination directory.
+// Symbolic link targets are relative to the link, hard link targets are
+// relative to the destination directory.
+func (p PathPolicy) sanitizeLink(name, linkname string, symlink bool) (string, error) {
+	if !symlink {
+		target, err := p.sanitize(linkname)
+		if err != nil {
+			return "", &PathError{name, fmt.Sprintf("link target %q escapes destination", linkname)}
+		}
+		return target, nil
+	}
+
+	target := trimVolume(linkname)
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join(path.Dir(name), target)
+	}
+	if local(target) {
+		return linkname, nil
+	}
+
+	if p == RejectUnsafe {
+		return "", &PathError{name, fmt.Sprintf("link target %q escapes destination", linkname)}
+	}
+	target, err := p.sanitize(target)
+	if err != nil {
+		return "", &PathError{name, fmt.Sprintf("link target %q escapes destination", linkname)}
+	}
+
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(name)), filepath.FromSlash(target))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// local reports whether name is a relative slash-separated path
+// that stays inside the directory it is joined to.
+func local(name string) bool {
+	return name == "." || filepath.IsLocal(filepath.FromSlash(name))
+}
+
+func trimVolume(name string) string {
+	name = filepath.ToSlash(name)
+
+	return name[len(filepath.VolumeName(name)):]
+}
+
+// inside checks that path, after resolving the symbolic links in its
+// existing parent directories, stays inside root.
+func inside(root, name, path string) error {
+	return insideDir(root, name, filepath.Dir(path))
+}
+
+// insideDir checks that dir, after resolving the symbolic links in it
+// as far as it exists, stays inside root.
+func insideDir(root, name, dir string) error {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	for {
+		real, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			rel, err := filepath.Rel(realRoot, real)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return &PathError{name, "path escapes destination through a symbolic link"}
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		// dir is not cleaned, as ".." must be resolved after the
+		// symbolic links before it.
+		parent, elem := filepath.Split(dir)
+		if elem == ".." {
+			return &PathError{name, "path resolves through a missing directory"}
+		}
+		if dir = strings.TrimRight(parent, string(filepath.Separator)); dir == "" {
+			dir = parent
+		}
+	}
+}
+
+// resolveLink returns the target of the symbolic link fpath named name,
+// which must already be sanitized, so that it resolves inside root through
+// the symbolic links existing in root.
+func (p PathPolicy) resolveLink(root, name, fpath, linkname string) (string, error) {
+	dir := filepath.Dir(fpath)
+	err := insideDir(root, name, dir+string(filepath.Separator)+filepath.FromSlash(linkname))
+	if err == nil || p == RejectUnsafe {
+		return linkname, err
+	}
+	var pe *PathError
+	if !errors.As(err, &pe) {
+		return "", err
+	}
+
+	// Sanitize the target as seen from the real directory of the link.
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(realRoot, filepath.Join(realDir, filepath.FromSlash(linkname)))
+	if err != nil {
+		return "", err
+	}
+	target, err := p.sanitize(filepath.ToSlash(rel))
+	if err != nil {
+		return "", &PathError{name, fmt.Sprintf("link target %q escapes destination", linkname)}
+	}
+	if rel, err = filepath.Rel(realDir, filepath.Join(realRoot, filepath.FromSlash(target))); err != nil {
+		return "", err
+	}
+	if err := insideDir(root, name, dir+string(filepath.Separator)+rel); err != nil {
+		return "", err
+	}
+
+	return filepath.ToSlash(rel), nil
+}
@@ -0,0 +1,182 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSanitize(t *testing.T) {
+	tc := []struct {
+		name            string
+		strip, rewrite  string
+		rejectSucceeded bool
+	}{
+		{"a/b", "a/b", "a/b", true},
+		{"a/../b", "b", "b", true},
+		{"./a/", "a", "a", true},
+		{"../../etc/x", "etc/x", "etc/x", false},
+		{"a/../../b", "a/b", "b", false},
+		{"/abs/p", "abs/p", "abs/p", false},
+	}
+	for _, i := range tc {
+		if name, err := RejectUnsafe.sanitize(i.name); i.rejectSucceeded {
+			if err != nil || name != i.strip {
+				t.Errorf("%q: expected %q; got %q, %v", i.name, i.strip, name, err)
+			}
+		} else {
+			var pe *PathError
+			if !errors.As(err, &pe) || pe.Name != i.name {
+				t.Errorf("%q: expected PathError; got %v", i.name, err)
+			}
+		}
+		if name, err := StripUnsafe.sanitize(i.name); err != nil || name != i.strip {
+			t.Errorf("%q: expected %q; got %q, %v", i.name, i.strip, name, err)
+		}
+		if name, err := RewriteUnsafe.sanitize(i.name); err != nil || name != i.rewrite {
+			t.Errorf("%q: expected %q; got %q, %v", i.name, i.rewrite, name, err)
+		}
+	}
+}
+
+func TestUnpackToFilesUnsafe(t *testing.T) {
+	tc := [][]File{
+		{{Name: "../evil", Body: []byte("evil")}},
+		{{Name: "/evil", Body: []byte("evil")}},
+		{{Name: "link", Mode: fs.ModeSymlink, Linkname: "../evil"}},
+		{{Name: "link", Mode: fs.ModeSymlink, Linkname: "/etc"}},
+		{{Name: "hard", Linkname: "../evil"}},
+		{
+			{Name: "b", Mode: fs.ModeSymlink, Linkname: "."},
+			{Name: "c", Mode: fs.ModeSymlink, Linkname: "b/.."},
+			{Name: "c/evil", Body: []byte("evil")},
+		},
+		{
+			{Name: "y", Mode: fs.ModeSymlink, Linkname: "."},
+			{Name: "x", Mode: fs.ModeSymlink, Linkname: "y/.."},
+		},
+		{
+			{Name: "d", Mode: fs.ModeSymlink, Linkname: "."},
+			{Name: "d/x", Mode: fs.ModeSymlink, Linkname: "../evil"},
+		},
+		{
+			{Name: "x", Mode: fs.ModeSymlink, Linkname: "y/.."},
+			{Name: "y", Mode: fs.ModeSymlink, Linkname: "."},
+		},
+		{
+			{Name: "a/b", Mode: fs.ModeSymlink, Linkname: ".."},
+			{Name: "c", Mode: fs.ModeSymlink, Linkname: "a/b/.."},
+			{Name: "c", IsDir: true, Mode: fs.ModeDir | 0777},
+		},
+	}
+	for _, files := range tc {
+		var buf bytes.Buffer
+		if err := Pack(&buf, TAR, files...); err != nil {
+			t.Fatal(err)
+		}
+		root := t.TempDir()
+		dest := filepath.Join(root, "dest")
+		if err := os.Mkdir(dest, 0755); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pe *PathError
+		if err := UnpackToFiles(&buf, dest); !errors.As(err, &pe) {
+			t.Errorf("%q: expected PathError; got %v", files[len(files)-1].Name, err)
+		}
+		if _, err := os.Lstat(filepath.Join(root, "evil")); err == nil {
+			t.Errorf("%q: expected no file outside destination; got file", files[len(files)-1].Name)
+		}
+		if after, err := os.Stat(root); err != nil || after.Mode() != info.Mode() || !after.ModTime().Equal(info.ModTime()) {
+			t.Errorf("%q: expected parent of destination untouched; got %v", files[len(files)-1].Name, after.Mode())
+		}
+		if name := linkOutside(t, dest); name != "" {
+			t.Errorf("%q: expected no link outside destination; got %s", files[len(files)-1].Name, name)
+		}
+	}
+}
+
+// linkOutside returns the first symbolic link in dest resolving outside it.
+func linkOutside(t *testing.T, dest string) (name string) {
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filepath.WalkDir(dest, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.Type()&fs.ModeSymlink == 0 {
+			return err
+		}
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			if rel, err := filepath.Rel(realDest, real); err != nil || !filepath.IsLocal(rel) && rel != "." {
+				name = path
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+
+	return
+}
+
+func TestUnpackToFilesPathPolicy(t *testing.T) {
+	files := []File{
+		{Name: "../../etc/x", Body: []byte("x")},
+		{Name: "link", Mode: fs.ModeSymlink, Linkname: "/etc/x"},
+	}
+	var buf bytes.Buffer
+	if err := Pack(&buf, TAR, files...); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	if err := (&Unpacker{PathPolicy: StripUnsafe}).UnpackToFiles(&buf, dest); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dest, "etc/x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "x" {
+		t.Errorf("expected %q; got %q", "x", b)
+	}
+	link, err := os.Readlink(filepath.Join(dest, "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.FromSlash("etc/x"); link != expected {
+		t.Errorf("expected %q; got %q", expected, link)
+	}
+}
+
+func TestUnpackToFilesPathPolicyResolve(t *testing.T) {
+	files := []File{
+		{Name: "y", Mode: fs.ModeSymlink, Linkname: "."},
+		{Name: "x", Mode: fs.ModeSymlink, Linkname: "y/.."},
+		{Name: "y/z", Mode: fs.ModeSymlink, Linkname: "../evil"},
+	}
+	for _, policy := range []PathPolicy{StripUnsafe, RewriteUnsafe} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, TAR, files...); err != nil {
+			t.Fatal(err)
+		}
+
+		dest := t.TempDir()
+		if err := (&Unpacker{PathPolicy: policy}).UnpackToFiles(&buf, dest); err != nil {
+			t.Fatal(err)
+		}
+		for name, expected := range map[string]string{"x": ".", "z": "evil"} {
+			if link, err := os.Readlink(filepath.Join(dest, name)); err != nil || link != expected {
+				t.Errorf("%d %s: expected %q; got %q, %v", policy, name, expected, link, err)
+			}
+		}
+		if name := linkOutside(t, dest); name != "" {
+			t.Errorf("%d: expected no link outside destination; got %s", policy, name)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+)
+
+// selectReader skips the entries not selected by the options of an Unpacker
+// and strips the leading elements of entry names.
+type selectReader struct {
+	Reader
+	include, exclude matcher
+	all              bool
+	strip            int
+	onEvent          func(Event)
+}
+
+func (u *Unpacker) selected() bool {
+	return len(u.Include) > 0 || len(u.Exclude) > 0 || u.StripComponents > 0
+}
+
+// selector returns a function wrapping the Reader to select entries
+// like set in u.
+func (u *Unpacker) selector() (func(Reader) Reader, error) {
+	if !u.selected() {
+		return func(ar Reader) Reader { return ar }, nil
+	}
+
+	r := &selectReader{all: len(u.Include) == 0, strip: u.StripComponents, onEvent: u.OnEvent}
+	for _, i := range u.Include {
+		if err := r.include.add("", i); err != nil {
+			return nil, err
+		}
+	}
+	for _, i := range u.Exclude {
+		if err := r.exclude.add("", i); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(ar Reader) Reader {
+		r.Reader = ar
+		return r
+	}, nil
+}
+
+func (r *selectReader) Next() (*Header, error) {
+	for {
+		header, err := r.Reader.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		name := clean(header.Name)
+		if !r.included(name, header.IsDir) {
+			skipped(r.onEvent, header, "not included")
+			continue
+		}
+		if r.excluded(name, header.IsDir) {
+			skipped(r.onEvent, header, "excluded")
+			continue
+		}
+		if r.strip > 0 {
+			var ok bool
+			if header.Name, ok = stripComponents(header.Name, r.strip); !ok {
+				skipped(r.onEvent, header, "stripped")
+				continue
+			}
+			if header.isHardLink() {
+				if header.Linkname, ok = stripComponents(header.Linkname, r.strip); !ok {
+					skipped(r.onEvent, header, "link target stripped")
+					continue
+				}
+			}
+		}
+
+		return header, nil
+	}
+}
+
+// included reports whether name, or a directory containing it, is included.
+func (r *selectReader) included(name string, isDir bool) bool {
+	if r.all {
+		return true
+	}
+	for _, dir := range parents(name) {
+		if r.include.match(dir, true) {
+			return true
+		}
+	}
+
+	return r.include.match(name, isDir)
+}
+
+// excluded reports whether name, or a directory containing it, is excluded.
+func (r *selectReader) excluded(name string, isDir bool) bool {
+	for _, dir := range parents(name) {
+		if r.exclude.match(dir, true) {
+			return true
+		}
+	}
+
+	return r.exclude.match(name, isDir)
+}
+
+// stripComponents removes the first n elements of name.
+// It reports false if no element is left.
+func stripComponents(name string, n int) (string, bool) {
+	dir := strings.HasSuffix(name, "/")
+	elems := strings.Split(strings.TrimPrefix(clean(name), "/"), "/")
+	if len(elems) <= n {
+		return "", false
+	}
+	name = strings.Join(elems[n:], "/")
+	if dir {
+		name += "/"
+	}
+
+	return name, true
+}
+
+// ExtractEntry writes the contents of the regular file name
+// in the archive read from r to w.
+// An error wrapping fs.ErrNotExist is returned if there is no such entry.
+func ExtractEntry(r io.Reader, name string, w io.Writer) error {
+	return defaultUnpacker.ExtractEntry(r, name, w)
+}
+
+// ExtractEntry writes the contents of the regular file name
+// in the archive read from r to w like ExtractEntry, using the options of u.
+// The name is matched after StripComponents is applied.
+func (u *Unpacker) ExtractEntry(r io.Reader, name string, w io.Writer) error {
+	ar, err := u.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	name = clean(name)
+	for {
+		header, err := ar.Next()
+		if err == io.EOF {
+			return fmt.Errorf("archive: %q: %w", name, fs.ErrNotExist)
+		} else if err != nil {
+			return err
+		}
+		if clean(header.Name) != name {
+			continue
+		}
+
+		if header.IsDir || header.Linkname != "" {
+			return fmt.Errorf("archive: %q is not a regular file", name)
+		}
+		_, err = io.Copy(w, ar)
+
+		return err
+	}
+}
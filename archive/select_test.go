@@ -0,0 +1,101 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var bundle = []File{
+	{Name: "release/", IsDir: true},
+	{Name: "release/manifest.json", Body: []byte("{}")},
+	{Name: "release/bin/", IsDir: true},
+	{Name: "release/bin/app", Body: []byte("app")},
+	{Name: "release/docs/", IsDir: true},
+	{Name: "release/docs/README.md", Body: []byte("readme")},
+}
+
+func TestUnpackerSelect(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Pack(&buf, TAR, bundle...); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := []struct {
+		unpacker *Unpacker
+		expected []string
+	}{
+		{&Unpacker{Include: []string{"*.json", "bin/"}}, []string{"release/manifest.json", "release/bin/", "release/bin/app"}},
+		{&Unpacker{Exclude: []string{"docs/"}, StripComponents: 1}, []string{"manifest.json", "bin/", "bin/app"}},
+		{&Unpacker{Include: []string{"release/docs"}, StripComponents: 2}, []string{"README.md"}},
+	}
+	for _, i := range tc {
+		fs, err := i.unpacker.Unpack(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range fs {
+			names = append(names, f.Name)
+		}
+		if !reflect.DeepEqual(names, i.expected) {
+			t.Errorf("expected %q; got %q", i.expected, names)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := (&Unpacker{Include: []string{"*.md"}, StripComponents: 1}).UnpackToFiles(bytes.NewReader(buf.Bytes()), dir); err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	sort.Strings(files)
+	if expected := []string{"docs/README.md"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("expected %q; got %q", expected, files)
+	}
+}
+
+func TestExtractEntry(t *testing.T) {
+	for _, format := range []Format{ZIP, TAR} {
+		var buf bytes.Buffer
+		if err := Pack(&buf, format, bundle...); err != nil {
+			t.Fatal(err)
+		}
+
+		var out bytes.Buffer
+		if err := ExtractEntry(bytes.NewReader(buf.Bytes()), "release/manifest.json", &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != "{}" {
+			t.Errorf("%s: expected %q; got %q", format, "{}", out.String())
+		}
+		if err := ExtractEntry(bytes.NewReader(buf.Bytes()), "missing", &out); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: expected ErrNotExist; got %v", format, err)
+		}
+		if err := ExtractEntry(bytes.NewReader(buf.Bytes()), "release/bin", &out); err == nil {
+			t.Errorf("%s: expected error; got nil", format)
+		}
+	}
+
+	// Encrypted entries are decrypted, and only the extracted one is read.
+	f, err := os.Open("testdata/crypto.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out bytes.Buffer
+	if err := (&Unpacker{Password: "secret"}).ExtractEntry(f, "2.txt", &out); err != nil || out.String() != "2" {
+		t.Errorf("expected %q; got %q, %v", "2", out.String(), err)
+	}
+}
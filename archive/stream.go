@@ -0,0 +1,185 @@
+package archive
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Header represents a single entry in an archive.
+// The metadata fields have the same meaning as in File.
+// CompressedSize and CRC32 are only set by Readers and ignored by Writers.
+type Header struct {
+	Name     string
+	Size     int64 // Size is -1 if unknown.
+	IsDir    bool
+	Mode     fs.FileMode
+	ModTime  time.Time
+	Linkname string
+	Uid, Gid int
+	Method   Method
+
+	CompressedSize int64  // CompressedSize is -1 if unknown.
+	CRC32          uint32 // CRC32 is zero if the format does not record it.
+}
+
+// Reader provides sequential access to the contents of an archive.
+type Reader interface {
+	// Next advances to the next entry in the archive.
+	// io.EOF is returned at the end of the input.
+	Next() (*Header, error)
+	// Read reads from the current entry in the archive.
+	Read(b []byte) (int, error)
+	// Close releases any resources held by the Reader.
+	Close() error
+}
+
+// Writer provides sequential writing of an archive.
+type Writer interface {
+	// WriteHeader writes hdr and prepares to accept the entry's contents.
+	// If hdr.Size is -1, the contents are spooled until the entry is complete.
+	WriteHeader(hdr *Header) error
+	// Write writes to the current entry in the archive.
+	Write(b []byte) (int, error)
+	// Close finishes writing the archive. It does not close the underlying writer.
+	Close() error
+}
+
+// NewReader creates a new Reader reading from r.
+// The archive format is detected from the magic bytes of the registered
+// formats. If r has a Name() string method, like *os.File, its extension
+// is used when the magic bytes are ambiguous or unknown.
+// ZIP archives need random access, so if r is not an io.ReaderAt of known size,
+// it is spooled to a temporary file first.
+func NewReader(r io.Reader) (Reader, error) {
+	return defaultUnpacker.NewReader(r)
+}
+
+// NewWriter creates a new Writer writing an archive of the given format to w.
+func NewWriter(w io.Writer, format Format) (Writer, error) {
+	return defaultPacker.NewWriter(w, format)
+}
+
+// NewReader creates a new Reader reading from r like NewReader,
+// using the options of u.
+func (u *Unpacker) NewReader(r io.Reader) (Reader, error) {
+	ar, _, err := u.newReader(r)
+	return ar, err
+}
+
+// newReader is like NewReader and also returns the detected format.
+func (u *Unpacker) newReader(r io.Reader) (Reader, *format, error) {
+	selector, err := u.selector()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	name := fileName(r)
+	r, limit := u.limit(r)
+	n := maxMagic()
+
+	var b []byte
+	if ra, size, ok := sizeReaderAt(r); ok {
+		b = make([]byte, min(int64(n), size))
+		if _, err := ra.ReadAt(b, 0); err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+	} else {
+		br := bufio.NewReaderSize(r, n)
+		if b, err = br.Peek(n); err != nil && err != io.EOF {
+			return nil, nil, err
+		}
+		r = br
+	}
+
+	f := detect(b, name)
+	if f == nil || f.unpack == nil {
+		return nil, nil, errors.New("unsupport file format")
+	}
+
+	ar, err := f.unpack(r, u)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ar = selector(limit(ar))
+	if u.OnEvent != nil {
+		ar = &eventReader{Reader: ar, onEvent: u.OnEvent}
+	}
+
+	return ar, f, nil
+}
+
+// NewWriter creates a new Writer writing an archive of the given format to w,
+// using the options of p.
+func (p *Packer) NewWriter(w io.Writer, format Format) (Writer, error) {
+	f := lookup(format)
+	if f == nil {
+		return nil, errors.New("unknow format")
+	}
+	if f.pack == nil {
+		return nil, fmt.Errorf("archive: packing %s is not supported", f.name)
+	}
+
+	aw, err := f.pack(w, p)
+	if err != nil {
+		return nil, err
+	}
+	if p.Deterministic {
+		modTime, err := p.modTime()
+		if err != nil {
+			return nil, err
+		}
+		aw = &deterministicWriter{Writer: aw, modTime: modTime}
+	}
+	if p.OnEvent != nil {
+		aw = &eventWriter{Writer: aw, onEvent: p.OnEvent}
+	}
+
+	return aw, nil
+}
+
+func fileName(r interface{}) string {
+	if r, ok := r.(interface{ Name() string }); ok {
+		return r.Name()
+	}
+
+	return ""
+}
+
+// match reports whether b starts with magic. '?' in magic matches any byte.
+func match(magic string, b []byte) bool {
+	if len(magic) > len(b) {
+		return false
+	}
+	b = b[:len(magic)]
+	for i, c := range b {
+		if magic[i] != c && magic[i] != '?' {
+			return false
+		}
+	}
+	return true
+}
+
+func sizeReaderAt(r io.Reader) (io.ReaderAt, int64, bool) {
+	ra, ok := r.(io.ReaderAt)
+	if !ok {
+		return nil, 0, false
+	}
+
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		return ra, r.Size(), true
+	case interface{ Stat() (fs.FileInfo, error) }:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil, 0, false
+		}
+		return ra, info.Size(), true
+	}
+
+	return nil, 0, false
+}
@@ -0,0 +1,79 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReaderWriter(t *testing.T) {
+	for _, format := range []Format{ZIP, TAR} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteHeader(&Header{Name: "dir", IsDir: true}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteHeader(&Header{Name: "dir/known.txt", Size: 5}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(w, strings.NewReader("known")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteHeader(&Header{Name: "unknown.txt", Size: -1}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(w, strings.NewReader("unknown size")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Hide io.ReaderAt to exercise the non-seekable path.
+		r, err := NewReader(struct{ io.Reader }{&buf})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []struct {
+			name, body string
+			isDir      bool
+		}{
+			{"dir/", "", true},
+			{"dir/known.txt", "known", false},
+			{"unknown.txt", "unknown size", false},
+		}
+		for _, e := range expected {
+			hdr, err := r.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr.Name != e.name || hdr.IsDir != e.isDir {
+				t.Errorf("expected %q(%v); got %q(%v)", e.name, e.isDir, hdr.Name, hdr.IsDir)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != e.body {
+				t.Errorf("expected %q; got %q", e.body, b)
+			}
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("expected EOF; got %v", err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewReaderUnknownFormat(t *testing.T) {
+	if _, err := NewReader(strings.NewReader("PK")); err == nil {
+		t.Error("expected error; got nil")
+	}
+}
@@ -2,72 +2,234 @@ package archive
 
 import (
 	"archive/tar"
-	"bytes"
-	"compress/gzip"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"os"
+	"strings"
 )
 
-const tarMagic = "\x1f\x8b\x08\x00"
+type tarWriter struct {
+	cw io.WriteCloser
+	tw *tar.Writer
 
-func packTar(w io.Writer, files ...File) error {
-	gw := gzip.NewWriter(w)
-	tw := tar.NewWriter(gw)
+	// pending holds the header of an entry of unknown size
+	// whose contents are being spooled.
+	pending *tar.Header
+	spool   *os.File
+}
+
+func newTarWriter(w io.Writer, format Format, p *Packer) (*tarWriter, error) {
+	if p.Password != "" {
+		return nil, fmt.Errorf("archive: %s does not support encryption", format)
+	}
+
+	cw, err := compressor(w, format, p.Level, p.Concurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tarWriter{cw: cw, tw: tar.NewWriter(cw)}, nil
+}
 
-	for _, file := range files {
-		header := &tar.Header{
-			Name: file.Name,
-			Mode: 0600,
-			Size: int64(len(file.Body)),
+func (w *tarWriter) WriteHeader(hdr *Header) error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	header := &tar.Header{
+		Name:    hdr.Name,
+		Mode:    tarMode(hdr.Mode),
+		Size:    hdr.Size,
+		ModTime: hdr.ModTime,
+		Uid:     hdr.Uid,
+		Gid:     hdr.Gid,
+	}
+	switch {
+	case hdr.IsDir:
+		header.Typeflag = tar.TypeDir
+		header.Size = 0
+		if header.Mode == 0 {
+			header.Mode = 0700
 		}
-		if err := tw.WriteHeader(header); err != nil {
-			return err
+		if !strings.HasSuffix(header.Name, "/") {
+			header.Name += "/"
 		}
-		if _, err := tw.Write(file.Body); err != nil {
+	case hdr.isSymlink():
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = hdr.Linkname
+		header.Size = 0
+	case hdr.isHardLink():
+		header.Typeflag = tar.TypeLink
+		header.Linkname = hdr.Linkname
+		header.Size = 0
+	default:
+		header.Typeflag = tar.TypeReg
+	}
+	if header.Mode == 0 {
+		header.Mode = 0600
+	}
+
+	if header.Size < 0 {
+		spool, err := os.CreateTemp("", "archive-*")
+		if err != nil {
 			return err
 		}
+		w.pending, w.spool = header, spool
+
+		return nil
+	}
+
+	return w.tw.WriteHeader(header)
+}
+
+func (w *tarWriter) Write(b []byte) (int, error) {
+	if w.spool != nil {
+		return w.spool.Write(b)
+	}
+
+	return w.tw.Write(b)
+}
+
+// flush writes the spooled entry, if any, now that its size is known.
+func (w *tarWriter) flush() error {
+	if w.spool == nil {
+		return nil
+	}
+	defer func() {
+		removeFile(w.spool)
+		w.pending, w.spool = nil, nil
+	}()
+
+	size, err := w.spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := w.spool.Seek(0, io.SeekStart); err != nil {
+		return err
 	}
 
-	if err := tw.Close(); err != nil {
+	w.pending.Size = size
+	if err := w.tw.WriteHeader(w.pending); err != nil {
 		return err
 	}
+	_, err = io.Copy(w.tw, w.spool)
 
-	return gw.Close()
+	return err
 }
 
-func unpackTar(b []byte) ([]File, error) {
-	gr, err := gzip.NewReader(bytes.NewReader(b))
+func (w *tarWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+
+	return w.cw.Close()
+}
+
+// tarMode converts mode to the tar permission bits.
+func tarMode(mode fs.FileMode) int64 {
+	m := int64(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		m |= 04000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= 02000
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= 01000
+	}
+
+	return m
+}
+
+type tarReader struct {
+	rc      io.ReadCloser
+	tr      *tar.Reader
+	plain   bool
+	onEvent func(Event)
+	count   func(*Header) error
+}
+
+func newTarReader(r io.Reader, format Format, onEvent func(Event)) (*tarReader, error) {
+	rc, err := decompressor(r, format)
 	if err != nil {
 		return nil, err
 	}
-	tr := tar.NewReader(gr)
 
-	var fs []File
+	return &tarReader{rc: rc, tr: tar.NewReader(rc), plain: format == PlainTAR, onEvent: onEvent}, nil
+}
+
+func (r *tarReader) Next() (*Header, error) {
 	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
+		header, err := r.tr.Next()
+		if err == io.EOF && !r.plain {
+			// Drain the compressed stream, so that its checksum is verified.
+			if _, err := io.Copy(io.Discard, r.rc); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		} else if err != nil {
 			return nil, err
 		}
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			fs = append(fs, File{Name: header.Name, IsDir: true})
-		case tar.TypeReg:
-			var buf bytes.Buffer
-			if _, err := io.Copy(&buf, tr); err != nil {
+		if hdr, ok := tarHeader(header); ok {
+			if r.plain {
+				hdr.CompressedSize = hdr.Size
+			}
+			return hdr, nil
+		}
+		skip := &Header{Name: header.Name, Size: header.Size}
+		if r.count != nil {
+			if err := r.count(skip); err != nil {
 				return nil, err
 			}
-			fs = append(fs, File{Name: header.Name, Body: buf.Bytes()})
-		default:
-			log.Printf(
-				"ExtractTarGz: uknown type: %v in %s",
-				header.Typeflag,
-				header.Name)
 		}
+		if r.onEvent != nil {
+			skipped(r.onEvent, skip, fmt.Sprintf("unknown type %v", header.Typeflag))
+			continue
+		}
+		log.Printf(
+			"ExtractTarGz: uknown type: %v in %s",
+			header.Typeflag,
+			header.Name)
+	}
+}
+
+func (r *tarReader) countSkipped(count func(*Header) error) { r.count = count }
+
+// tarHeader converts header to a Header.
+// It reports false for unsupported entry types.
+func tarHeader(header *tar.Header) (*Header, bool) {
+	hdr := &Header{
+		Name:           header.Name,
+		Mode:           header.FileInfo().Mode() & modeMask,
+		ModTime:        header.ModTime,
+		Uid:            header.Uid,
+		Gid:            header.Gid,
+		CompressedSize: -1,
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		hdr.IsDir = true
+	case tar.TypeReg:
+		hdr.Size = header.Size
+	case tar.TypeSymlink, tar.TypeLink:
+		hdr.Linkname = header.Linkname
+	default:
+		return nil, false
 	}
 
-	return fs, nil
+	return hdr, true
+}
+
+func (r *tarReader) Read(b []byte) (int, error) {
+	return r.tr.Read(b)
+}
+
+func (r *tarReader) Close() error {
+	return r.rc.Close()
 }
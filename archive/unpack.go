@@ -1,80 +1,418 @@
 package archive
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"time"
+
+	"golang.org/x/text/encoding"
 )
 
-func match(magic string, b []byte) bool {
-	if len(magic) != len(b) {
-		return false
-	}
-	for i, c := range b {
-		if magic[i] != c && magic[i] != '?' {
-			return false
-		}
-	}
-	return true
+// Unpacker holds the options used to unpack archives.
+// The zero value is ready to use.
+type Unpacker struct {
+	// PathPolicy decides how entries whose path would escape
+	// the destination directory are handled. Symbolic and hard links
+	// are subject to the same policy.
+	PathPolicy PathPolicy
+
+	// Password decrypts encrypted ZIP entries, using either
+	// WinZip AES or the traditional PKWARE encryption.
+	Password string
+	// Charset decodes the names of ZIP entries without the UTF-8 flag nor
+	// an Info-ZIP Unicode Path extra field, like japanese.ShiftJIS.
+	// If nil, the charset is detected among Shift-JIS, GBK and CP437,
+	// unless the names are valid UTF-8.
+	Charset encoding.Encoding
+
+	// Limits guarding against decompression bombs, enforced while the
+	// archive is read. Zero means no limit. When a limit is exceeded,
+	// an error wrapping ErrLimitExceeded is returned.
+	MaxEntries   int     // maximum number of entries
+	MaxEntrySize int64   // maximum uncompressed size of an entry
+	MaxTotalSize int64   // maximum uncompressed size of all entries
+	MaxRatio     float64 // maximum ratio of uncompressed to compressed size
+
+	// Include, if not empty, limits the entries read to those matching
+	// at least one pattern, or inside a directory that does.
+	// Exclude skips the entries matching any pattern, or inside a directory
+	// that does. Patterns use the same syntax as in Packer and are matched
+	// against the entry names.
+	Include, Exclude []string
+	// StripComponents removes that many leading elements from entry names,
+	// like tar --strip-components. Entries with no element left are skipped.
+	StripComponents int
+
+	// Overwrite decides how UnpackToFiles handles existing files.
+	Overwrite OverwritePolicy
+	// Atomic makes UnpackToFiles extract into a temporary directory first.
+	Atomic bool
+
+	// OnEvent, if not nil, receives the events of the entries read,
+	// including those skipped. Warnings about unsupported entries are sent
+	// as EntrySkipped events instead of being logged.
+	OnEvent func(Event)
 }
 
+var defaultUnpacker = &Unpacker{}
+
 // Unpack decompresses an archive to File struct.
 func Unpack(r io.Reader) ([]File, error) {
-	b, err := io.ReadAll(r)
+	return defaultUnpacker.Unpack(r)
+}
+
+// UnpackToFiles decompresses an archive to files.
+// Entries with unsafe paths are rejected.
+func UnpackToFiles(r io.Reader, dest string) error {
+	return defaultUnpacker.UnpackToFiles(r, dest)
+}
+
+// Unpack decompresses an archive to File struct.
+func (u *Unpacker) Unpack(r io.Reader) ([]File, error) {
+	ar, err := u.NewReader(r)
 	if err != nil {
 		return nil, err
 	}
-	switch {
-	case match(zipMagic, b[:len(zipMagic)]):
-		return unpackZip(b)
-	case match(tarMagic, b[:len(tarMagic)]):
-		return unpackTar(b)
-	default:
-		return nil, errors.New("unsupport file format")
+	defer ar.Close()
+
+	var fs []File
+	for {
+		header, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		file := header.file()
+		if !header.IsDir && header.Linkname == "" {
+			var buf bytes.Buffer
+			if _, err := io.Copy(&buf, ar); err != nil {
+				return nil, err
+			}
+			file.Body = buf.Bytes()
+		}
+		fs = append(fs, file)
 	}
+
+	return fs, nil
 }
 
 // UnpackToFiles decompresses an archive to files.
-func UnpackToFiles(r io.Reader, dest string) error {
-	files, err := Unpack(r)
+// Entries are streamed to disk one at a time. File mode, modification time,
+// symbolic links and hard links are restored, and so is ownership when
+// running as root. No entry is written outside dest, and the mode and time
+// of a directory are never restored through a symbolic link.
+// Existing files are handled according to u.Overwrite.
+//
+// If u.Atomic is set, the archive is extracted into a temporary directory
+// next to dest, which is removed if the extraction fails, leaving dest
+// untouched. On success, the temporary directory is renamed to dest
+// if dest does not exist; otherwise the extracted files are moved
+// into dest one by one. Files that would replace a directory, or the
+// reverse, are detected before any is moved, but moving them into an
+// existing dest is not atomic: if it fails midway, dest is left partially
+// updated.
+func (u *Unpacker) UnpackToFiles(r io.Reader, dest string) error {
+	ar, err := u.NewReader(r)
 	if err != nil {
 		return err
 	}
+	defer ar.Close()
 
-	for _, file := range files {
-		fpath := filepath.Join(dest, file.Name)
-		if file.IsDir {
-			dir, err := os.Stat(fpath)
-			if err != nil {
-				if os.IsNotExist(err) {
-					if err := os.MkdirAll(fpath, 0755); err != nil {
-						return err
-					}
-				} else {
-					return err
+	if !u.Atomic {
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return err
+		}
+		dirs, err := u.extract(ar, dest, dest)
+		if err != nil {
+			return err
+		}
+		return restoreDirs(dest, dirs)
+	}
+
+	dest = filepath.Clean(dest)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// The extraction root is created inside tmp, so that it gets
+	// the usual permissions instead of those of a temporary directory.
+	root := filepath.Join(tmp, "root")
+	if err := os.Mkdir(root, 0755); err != nil {
+		return err
+	}
+	dirs, err := u.extract(ar, root, dest)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Lstat(dest)
+	switch {
+	case os.IsNotExist(err):
+		err = os.Rename(root, dest)
+	case err == nil:
+		if err = conflicts(root, dest); err == nil {
+			err = merge(root, dest)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return restoreDirs(dest, dirs)
+}
+
+// extract extracts the entries of ar into root, checking the overwrite policy
+// against the existing files in dest. It returns the directory entries,
+// whose times are to be restored last.
+func (u *Unpacker) extract(ar Reader, root, dest string) ([]*Header, error) {
+	var dirs []*Header
+	for {
+		header, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Name, err = u.PathPolicy.sanitize(header.Name); err != nil {
+			return nil, err
+		}
+		if header.Linkname != "" && !header.IsDir {
+			if header.Linkname, err = u.PathPolicy.sanitizeLink(
+				header.Name, header.Linkname, header.isSymlink(),
+			); err != nil {
+				return nil, err
+			}
+		}
+
+		fpath := filepath.Join(root, filepath.FromSlash(header.Name))
+		if err := inside(root, header.Name, fpath); err != nil {
+			return nil, err
+		}
+		if !header.IsDir {
+			if skip, err := u.Overwrite.skip(filepath.Join(dest, filepath.FromSlash(header.Name)), header); err != nil {
+				return nil, err
+			} else if skip {
+				skipEntry(ar, "file exists")
+				continue
+			}
+		}
+
+		switch {
+		case header.IsDir:
+			if info, err := os.Lstat(fpath); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+				// An existing symbolic link is kept if it points inside
+				// root, but the directory is never restored through it.
+				if err := insideDir(root, header.Name, fpath); err != nil {
+					return nil, err
 				}
-			} else if !dir.IsDir() {
-				return fmt.Errorf("cannot create directory %q: File exists", fpath)
+				continue
 			}
-		} else {
-			if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
-				return err
+			if err := mkdir(fpath, header.Mode.Perm()); err != nil {
+				return nil, err
+			}
+			dirs = append(dirs, header)
+			continue
+		case header.isSymlink():
+			if err := prepare(fpath); err != nil {
+				return nil, err
+			}
+			if header.Linkname, err = u.PathPolicy.resolveLink(root, header.Name, fpath, header.Linkname); err != nil {
+				return nil, err
+			}
+			if err := os.Symlink(header.Linkname, fpath); err != nil {
+				return nil, err
+			}
+		case header.isHardLink():
+			if err := prepare(fpath); err != nil {
+				return nil, err
+			}
+			target := filepath.Join(root, filepath.FromSlash(header.Linkname))
+			if _, err := os.Lstat(target); os.IsNotExist(err) && root != dest {
+				// The target was skipped and exists in dest.
+				target = filepath.Join(dest, filepath.FromSlash(header.Linkname))
+				if err := inside(dest, header.Name, target); err != nil {
+					return nil, err
+				}
+			} else if err := inside(root, header.Name, target); err != nil {
+				return nil, err
+			}
+			if err := os.Link(target, fpath); err != nil {
+				return nil, err
+			}
+			continue
+		default:
+			if err := writeFile(fpath, ar, header.Mode); err != nil {
+				return nil, err
 			}
+		}
+
+		if err := restore(fpath, header); err != nil {
+			return nil, err
+		}
+	}
+
+	return dirs, nil
+}
+
+// restoreDirs restores the times of the directories in dest,
+// innermost first, as creating their contents modifies them.
+func restoreDirs(dest string, dirs []*Header) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := restore(filepath.Join(dest, filepath.FromSlash(dirs[i].Name)), dirs[i]); err != nil {
+			return err
+		}
+	}
 
-			f, err := os.Create(fpath)
-			if err != nil {
+	return nil
+}
+
+// conflicts checks that merge can move the contents of the directory src
+// into dest, that is no file would replace a directory or the reverse.
+func conflicts(src, dest string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		d := filepath.Join(dest, e.Name())
+		info, err := os.Lstat(d)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		switch {
+		case e.IsDir() && info.IsDir():
+			if err := conflicts(filepath.Join(src, e.Name()), d); err != nil {
 				return err
 			}
-			if _, err := f.Write(file.Body); err != nil {
-				return err
+		case e.IsDir() || info.IsDir():
+			return &fs.PathError{Op: "merge", Path: d, Err: errors.New("file and directory conflict")}
+		}
+	}
+
+	return nil
+}
+
+// merge moves the contents of the directory src into the existing directory
+// dest, replacing existing files and merging directories.
+func merge(src, dest string) error {
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		s, d := filepath.Join(src, e.Name()), filepath.Join(dest, e.Name())
+		if e.IsDir() {
+			if info, err := os.Lstat(d); err == nil && info.IsDir() {
+				if err := merge(s, d); err != nil {
+					return err
+				}
+				continue
 			}
-			if err := f.Close(); err != nil {
-				return err
+		}
+		if err := os.Rename(s, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func mkdir(path string, perm fs.FileMode) error {
+	dir, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if perm == 0 {
+				perm = 0755
 			}
+			return os.MkdirAll(path, perm)
 		}
+		return err
+	} else if !dir.IsDir() {
+		return fmt.Errorf("cannot create directory %q: File exists", path)
+	}
+
+	return nil
+}
+
+// prepare creates the parent directory of path and removes any existing
+// file at path, so that a link can be created there.
+func prepare(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
 	}
 
 	return nil
 }
+
+func writeFile(path string, r io.Reader, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Never write through an existing symbolic link.
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	if mode.Perm() == 0 {
+		mode = 0666
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// restore applies the ownership, mode and modification time of header to path.
+// New files and directories are created with the umask applied, like tar does;
+// the exact mode and the ownership are only restored when running as root.
+func restore(path string, header *Header) error {
+	if !header.isSymlink() {
+		// Never restore through a symbolic link, which may have replaced
+		// a directory after it was created.
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return nil
+		}
+	}
+	if err := restoreOwner(path, header); err != nil {
+		return err
+	}
+	if header.isSymlink() || header.ModTime.IsZero() {
+		return nil
+	}
+
+	return os.Chtimes(path, time.Time{}, header.ModTime)
+}
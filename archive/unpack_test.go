@@ -1,25 +1,47 @@
 package archive
 
 import (
+	"bytes"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestUnPack(t *testing.T) {
-	tc := []string{"testdata/test.zip", "testdata/test.tar.gz"}
-	result := []File{
-		{Name: "1.txt", Body: []byte("1")},
-		{Name: "2.txt", Body: []byte("2")},
+	tc := []struct {
+		name   string
+		mode   fs.FileMode
+		method Method
+	}{
+		{"testdata/test.zip", 0666, Store},
+		{"testdata/test.tar.gz", 0600, DefaultMethod},
+		{"testdata/test.tar", 0600, DefaultMethod},
+		{"testdata/test.tar.bz2", 0600, DefaultMethod},
+		{"testdata/test.tar.xz", 0600, DefaultMethod},
+		{"testdata/test.tar.zst", 0600, DefaultMethod},
 	}
 	for _, i := range tc {
-		f, err := os.Open(i)
+		result := []File{
+			{Name: "1.txt", Body: []byte("1"), Mode: i.mode, Method: i.method},
+			{Name: "2.txt", Body: []byte("2"), Mode: i.mode, Method: i.method},
+		}
+
+		f, err := os.Open(i.name)
 		if err != nil {
 			t.Fatal(err)
 		}
 		fs, err := Unpack(f)
 		if err != nil {
-			t.Fatalf("Unpack %q failed: %v", i, err)
+			t.Fatalf("Unpack %q failed: %v", i.name, err)
+		}
+		for i := range fs {
+			if fs[i].ModTime.IsZero() {
+				t.Errorf("expected modification time of %q; got zero", fs[i].Name)
+			}
+			fs[i].ModTime = time.Time{}
 		}
 		if !reflect.DeepEqual(fs, result) {
 			t.Errorf("expected %#v; got %#v", result, fs)
@@ -34,3 +56,60 @@ func TestUnPack(t *testing.T) {
 		t.Error("expected error; got nil")
 	}
 }
+
+func TestUnpackToFilesMetadata(t *testing.T) {
+	modTime := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, format := range []Format{ZIP, TAR} {
+		files := []File{
+			{Name: "bin", IsDir: true, Mode: 0755, ModTime: modTime},
+			{Name: "bin/run.sh", Body: []byte("#!/bin/sh\n"), Mode: 0755, ModTime: modTime},
+			{Name: "run", Mode: fs.ModeSymlink | 0777, Linkname: "bin/run.sh", ModTime: modTime},
+		}
+		if format == TAR {
+			files = append(files, File{Name: "hard.sh", Linkname: "bin/run.sh", ModTime: modTime})
+		}
+
+		var buf bytes.Buffer
+		if err := Pack(&buf, format, files...); err != nil {
+			t.Fatal(err)
+		}
+		dest := t.TempDir()
+		if err := UnpackToFiles(&buf, dest); err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(filepath.Join(dest, "bin/run.sh"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm()&0100 == 0 {
+			t.Errorf("expected executable mode; got %v", info.Mode())
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("expected %v; got %v", modTime, info.ModTime())
+		}
+		if info, err := os.Stat(filepath.Join(dest, "bin")); err != nil {
+			t.Fatal(err)
+		} else if !info.ModTime().Equal(modTime) {
+			t.Errorf("expected %v; got %v", modTime, info.ModTime())
+		}
+
+		link, err := os.Readlink(filepath.Join(dest, "run"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link != "bin/run.sh" {
+			t.Errorf("expected %q; got %q", "bin/run.sh", link)
+		}
+
+		if format == TAR {
+			hard, err := os.Stat(filepath.Join(dest, "hard.sh"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(info, hard) {
+				t.Error("expected hard link; got different file")
+			}
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package archive
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Op is an operation applied to the entries of an archive by Update.
+type Op struct {
+	kind          opKind
+	name, newName string
+	file          File
+}
+
+type opKind int
+
+const (
+	opAdd opKind = iota
+	opReplace
+	opRename
+	opDelete
+)
+
+// Add adds file at the end of the archive.
+// The archive must not already have an entry of the same name.
+func Add(file File) Op {
+	return Op{kind: opAdd, name: clean(file.Name), file: file}
+}
+
+// Replace replaces the entry named file.Name with file.
+func Replace(file File) Op {
+	return Op{kind: opReplace, name: clean(file.Name), file: file}
+}
+
+// Rename renames the entry oldname to newname.
+// Renaming a directory also renames the entries inside it,
+// and hard links to renamed entries are updated.
+func Rename(oldname, newname string) Op {
+	return Op{kind: opRename, name: clean(oldname), newName: clean(newname)}
+}
+
+// Delete deletes the entry name.
+// Deleting a directory also deletes the entries inside it.
+func Delete(name string) Op {
+	return Op{kind: opDelete, name: clean(name)}
+}
+
+// Update copies the archive read from src to dst in the same format,
+// applying ops to its entries in order.
+// Unchanged and renamed ZIP entries are copied without recompression,
+// so encrypted entries do not need the password. Entries of other formats
+// are decompressed and compressed again.
+// An error wrapping fs.ErrNotExist is returned if an operation other than Add
+// matches no entry, and one wrapping fs.ErrExist if Add would duplicate one.
+func Update(src io.Reader, dst io.Writer, ops ...Op) error {
+	return defaultPacker.Update(src, dst, ops...)
+}
+
+// Update copies the archive read from src to dst like Update,
+// using the options of p for added and replaced entries. Copied entries,
+// raw or not, are also normalized if p.Deterministic is set and reported
+// to p.OnEvent.
+func (p *Packer) Update(src io.Reader, dst io.Writer, ops ...Op) error {
+	ar, f, err := defaultUnpacker.newReader(src)
+	if err != nil {
+		return err
+	}
+	defer ar.Close()
+
+	aw, err := p.NewWriter(dst, f.id)
+	if err != nil {
+		return err
+	}
+
+	u := &updater{ops: ops, matched: make([]bool, len(ops)), names: make(map[string]bool)}
+	zr, ok1 := ar.(*zipReader)
+	_, ok2 := unwrap(aw).(*zipWriter)
+	if ok1 && ok2 {
+		err = u.copyZip(zr, aw)
+	} else {
+		err = u.copy(ar, aw)
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, op := range ops {
+		switch {
+		case op.kind == opAdd:
+			if u.names[op.name] {
+				return fmt.Errorf("archive: adding %q: %w", op.file.Name, fs.ErrExist)
+			}
+			u.names[op.name] = true
+			if err := packEntry(aw, op.file); err != nil {
+				return err
+			}
+		case !u.matched[i]:
+			return fmt.Errorf("archive: %q: %w", op.name, fs.ErrNotExist)
+		}
+	}
+
+	return aw.Close()
+}
+
+// rawEntry is a ZIP entry copied without recompressing it.
+type rawEntry struct {
+	f      *zip.File
+	name   string  // raw name of the copy
+	header *Header // decoded header of the copy
+	// normalize replaces the time, mode and ownership of f
+	// with those of header.
+	normalize bool
+}
+
+// rawCopier is implemented by the ZIP Writer and the Writers wrapping it.
+type rawCopier interface {
+	copyRaw(*rawEntry) error
+}
+
+// unwrap returns the Writer wrapped by the Writers of NewWriter.
+func unwrap(aw Writer) Writer {
+	for {
+		switch w := aw.(type) {
+		case *eventWriter:
+			aw = w.Writer
+		case *deterministicWriter:
+			aw = w.Writer
+		default:
+			return aw
+		}
+	}
+}
+
+type updater struct {
+	ops     []Op
+	matched []bool
+	names   map[string]bool
+}
+
+// apply applies the operations to the entry name. It returns the new name
+// of the entry, the file replacing it if any, and false if it is deleted.
+func (u *updater) apply(name string) (string, *File, bool) {
+	var file *File
+	for i, op := range u.ops {
+		c := clean(name)
+		switch op.kind {
+		case opReplace:
+			if c == op.name {
+				file, name = &u.ops[i].file, u.ops[i].file.Name
+				u.matched[i] = true
+			}
+		case opRename:
+			if renamed, ok := op.rename(name); ok {
+				name = renamed
+				u.matched[i] = true
+			}
+		case opDelete:
+			if c == op.name || strings.HasPrefix(c, op.name+"/") {
+				u.matched[i] = true
+				return "", nil, false
+			}
+		}
+	}
+	u.names[clean(name)] = true
+
+	return name, file, true
+}
+
+// rename returns name renamed by the Rename operation op,
+// and whether op applies to it.
+func (op Op) rename(name string) (string, bool) {
+	c := clean(name)
+	if c != op.name && !strings.HasPrefix(c, op.name+"/") {
+		return name, false
+	}
+
+	renamed := op.newName + c[len(op.name):]
+	if strings.HasSuffix(name, "/") {
+		renamed += "/"
+	}
+
+	return renamed, true
+}
+
+// renameLink returns the target of a hard link renamed
+// like the entry it points to.
+func (u *updater) renameLink(linkname string) string {
+	for _, op := range u.ops {
+		if op.kind == opRename {
+			linkname, _ = op.rename(linkname)
+		}
+	}
+
+	return linkname
+}
+
+func (u *updater) copyZip(zr *zipReader, aw Writer) error {
+	zw := unwrap(aw).(*zipWriter)
+	zw.zw.SetComment(zr.zr.Comment)
+	for _, f := range zr.zr.File {
+		header := zr.rawHeader(f)
+		name, file, ok := u.apply(header.Name)
+		switch {
+		case !ok:
+		case file != nil:
+			if err := packEntry(aw, *file); err != nil {
+				return err
+			}
+		default:
+			raw := name
+			if name == header.Name {
+				// Keep the raw name of entries not renamed.
+				raw = f.Name
+			}
+			header.Name = name
+			if err := aw.(rawCopier).copyRaw(&rawEntry{f: f, name: raw, header: header}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (u *updater) copy(ar Reader, aw Writer) error {
+	for {
+		header, err := ar.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		name, file, ok := u.apply(header.Name)
+		switch {
+		case !ok:
+		case file != nil:
+			if err := packEntry(aw, *file); err != nil {
+				return err
+			}
+		default:
+			header.Name = name
+			if header.isHardLink() {
+				header.Linkname = u.renameLink(header.Linkname)
+			}
+			if err := aw.WriteHeader(header); err != nil {
+				return err
+			}
+			if header.IsDir || header.Linkname != "" {
+				continue
+			}
+			if _, err := io.Copy(aw, ar); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// clean returns the cleaned slash-separated name without a trailing slash.
+func clean(name string) string {
+	return path.Clean(strings.TrimSuffix(name, "/"))
+}
@@ -0,0 +1,126 @@
+package archive
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestUpdate(t *testing.T) {
+	src := []File{
+		{Name: "a.txt", Body: []byte("a")},
+		{Name: "b.txt", Body: []byte("b")},
+		{Name: "dir/", IsDir: true},
+		{Name: "dir/c.txt", Body: []byte("c")},
+		{Name: "old.txt", Body: []byte("old")},
+	}
+	for _, format := range []Format{ZIP, TAR, PlainTAR} {
+		var in, out bytes.Buffer
+		if err := Pack(&in, format, src...); err != nil {
+			t.Fatal(err)
+		}
+		if err := Update(bytes.NewReader(in.Bytes()), &out,
+			Delete("a.txt"),
+			Replace(File{Name: "b.txt", Body: []byte("B")}),
+			Rename("dir", "new"),
+			Delete("old.txt"),
+			Add(File{Name: "old.txt", Body: []byte("new")}),
+		); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+
+		fs, err := Unpack(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range fs {
+			got = append(got, f.Name+":"+string(f.Body))
+		}
+		expected := []string{"b.txt:B", "new/:", "new/c.txt:c", "old.txt:new"}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %q; got %q", format, expected, got)
+		}
+	}
+
+	var in bytes.Buffer
+	if err := Pack(&in, ZIP, src...); err != nil {
+		t.Fatal(err)
+	}
+	for _, ops := range [][]Op{
+		{Delete("missing")},
+		{Rename("missing", "x")},
+		{Replace(File{Name: "missing"})},
+	} {
+		if err := Update(bytes.NewReader(in.Bytes()), &bytes.Buffer{}, ops...); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected ErrNotExist; got %v", err)
+		}
+	}
+	if err := Update(bytes.NewReader(in.Bytes()), &bytes.Buffer{}, Add(File{Name: "a.txt"})); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("expected ErrExist; got %v", err)
+	}
+}
+
+func TestUpdateRaw(t *testing.T) {
+	// Encrypted entries are copied as is, without the password,
+	// even through the Writers wrapping the ZIP Writer.
+	b, err := os.ReadFile("testdata/crypto.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []string
+	for _, p := range []*Packer{
+		{},
+		{OnEvent: func(e Event) { events = append(events, e.Type.String()+" "+e.Header.Name) }},
+		{Deterministic: true},
+	} {
+		var out bytes.Buffer
+		if err := p.Update(bytes.NewReader(b), &out, Rename("1.txt", "one.txt")); err != nil {
+			t.Fatal(err)
+		}
+
+		fs, err := (&Unpacker{Password: "secret"}).Unpack(bytes.NewReader(out.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(fs) == 0 || fs[0].Name != "one.txt" || string(fs[0].Body) != "1" {
+			t.Errorf("expected one.txt(1); got %#v", fs)
+		}
+		if p.Deterministic {
+			for _, f := range fs {
+				if !f.ModTime.Equal(epoch) || f.Mode != 0644 {
+					t.Errorf("%s: expected %v %v; got %v %v", f.Name, epoch, fs[0].Mode, f.ModTime, f.Mode)
+				}
+			}
+		}
+	}
+	if !slices.Contains(events, "start one.txt") || !slices.Contains(events, "done one.txt") {
+		t.Errorf("expected events of one.txt; got %q", events)
+	}
+}
+
+func TestUpdateHardLink(t *testing.T) {
+	var in, out bytes.Buffer
+	if err := Pack(&in, TAR,
+		File{Name: "dir/a.txt", Body: []byte("a")},
+		File{Name: "link", Linkname: "dir/a.txt"},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if err := Update(bytes.NewReader(in.Bytes()), &out, Rename("dir", "new")); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := t.TempDir()
+	if err := UnpackToFiles(bytes.NewReader(out.Bytes()), dest); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dest, "link")); err != nil || string(b) != "a" {
+		t.Errorf("expected %q; got %q, %v", "a", b, err)
+	}
+}
@@ -2,60 +2,472 @@ package archive
 
 import (
 	"archive/zip"
-	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
+	"math"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding"
 )
 
 const zipMagic = "PK\x03\x04"
 
-func packZip(w io.Writer, files ...File) error {
+// maxLinkname limits the size of a symbolic link target stored in a zip entry.
+const maxLinkname = 4096
+
+// sampleSize is the number of bytes compressed to guess
+// whether an entry is incompressible.
+const sampleSize = 64 << 10
+
+// compressedExts lists the extensions of files already compressed.
+var compressedExts = map[string]bool{
+	".7z": true, ".aac": true, ".avi": true, ".br": true, ".bz2": true,
+	".docx": true, ".flac": true, ".gif": true, ".gz": true, ".heic": true,
+	".jar": true, ".jpeg": true, ".jpg": true, ".m4a": true, ".mkv": true,
+	".mov": true, ".mp3": true, ".mp4": true, ".ogg": true, ".png": true,
+	".pptx": true, ".rar": true, ".tgz": true, ".webm": true, ".webp": true,
+	".xlsx": true, ".xz": true, ".zip": true, ".zst": true,
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+	w  io.Writer
+
+	level               int
+	storeIncompressible bool
+	password            string
+	encryption          Encryption
+	charset             encoding.Encoding
+	// pending holds the header of an entry whose method is decided
+	// once sample is full or the entry is complete.
+	pending *zip.FileHeader
+	sample  []byte
+}
+
+func newZipWriter(w io.Writer, p *Packer) *zipWriter {
 	zw := zip.NewWriter(w)
+	if level := p.Level; level != 0 {
+		zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, level)
+		})
+	}
 
-	for _, file := range files {
-		f, err := zw.Create(file.Name)
-		if err != nil {
-			return err
+	return &zipWriter{
+		zw:                  zw,
+		level:               p.Level,
+		storeIncompressible: p.StoreIncompressible,
+		password:            p.Password,
+		encryption:          p.Encryption,
+		charset:             p.Charset,
+	}
+}
+
+// create creates the entry fh, encrypting it if a password is set.
+func (w *zipWriter) create(fh *zip.FileHeader) (io.Writer, error) {
+	if w.password == "" || strings.HasSuffix(fh.Name, "/") || fh.Mode()&fs.ModeSymlink != 0 {
+		return w.zw.CreateHeader(fh)
+	}
+
+	method, strength := fh.Method, w.encryption.strength()
+	fh.Method = aesMethod
+	fh.Flags |= 0x1
+	fh.Extra = append(fh.Extra, aesExtra(strength, method)...)
+	w.zw.RegisterCompressor(aesMethod, func(out io.Writer) (io.WriteCloser, error) {
+		return newAESWriter(out, w.password, strength, method, w.level)
+	})
+
+	return w.zw.CreateHeader(fh)
+}
+
+func (w *zipWriter) WriteHeader(hdr *Header) (err error) {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if hdr.isHardLink() {
+		return fmt.Errorf("archive: zip does not support hard link %q", hdr.Name)
+	}
+
+	fh := &zip.FileHeader{Name: hdr.Name, Modified: hdr.ModTime}
+	mode := hdr.Mode & modeMask
+	switch {
+	case hdr.IsDir:
+		if !strings.HasSuffix(fh.Name, "/") {
+			fh.Name += "/"
 		}
-		if _, err := f.Write(file.Body); err != nil {
-			return err
+		mode |= fs.ModeDir
+	case hdr.isSymlink():
+	case hdr.Method == Store:
+		fh.Method = zip.Store
+	case hdr.Method == DefaultMethod && w.storeIncompressible:
+		if compressedExts[strings.ToLower(path.Ext(hdr.Name))] {
+			fh.Method = zip.Store
+		} else {
+			w.pending, w.sample = fh, w.sample[:0]
 		}
+	default:
+		fh.Method = zip.Deflate
+	}
+	if hdr.Mode != 0 {
+		fh.SetMode(mode)
+	}
+	encodeName(fh, w.charset)
+
+	if w.pending != nil {
+		w.w = nil
+		return
+	}
+	if w.w, err = w.create(fh); err != nil {
+		return
+	}
+	if hdr.isSymlink() {
+		// Info-ZIP stores the link target as the entry contents.
+		_, err = io.WriteString(w.w, hdr.Linkname)
+	}
+
+	return
+}
+
+func (w *zipWriter) Write(b []byte) (int, error) {
+	if w.pending != nil {
+		w.sample = append(w.sample, b...)
+		if len(w.sample) >= sampleSize {
+			if err := w.flush(); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	if w.w == nil {
+		return 0, errors.New("archive: write before header")
+	}
+
+	return w.w.Write(b)
+}
+
+// flush writes the pending entry, if any, choosing its method from the sample.
+func (w *zipWriter) flush() (err error) {
+	if w.pending == nil {
+		return nil
 	}
 
-	return zw.Close()
+	fh := w.pending
+	w.pending = nil
+	if incompressible(w.sample) {
+		fh.Method = zip.Store
+	} else {
+		fh.Method = zip.Deflate
+	}
+	if w.w, err = w.create(fh); err != nil {
+		return
+	}
+	_, err = w.w.Write(w.sample)
+
+	return
 }
 
-func unpackZip(b []byte) ([]File, error) {
-	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+func (w *zipWriter) copyRaw(e *rawEntry) error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	w.w = nil
+
+	r, err := e.f.OpenRaw()
 	if err != nil {
+		return err
+	}
+	fh := e.f.FileHeader
+	if e.name != fh.Name {
+		fh.Name, fh.Flags = e.name, fh.Flags&^0x800
+		if !isASCII(e.name) {
+			fh.Flags |= 0x800
+		}
+	}
+	if e.normalize {
+		// Replace the time and ownership extra fields, as CreateHeader
+		// would write them for e.header.
+		fh.Extra = append(stripExtra(fh.Extra, extTimeExtraID, 0x000d, 0x5855, 0x7875), extTimeExtra(e.header.ModTime)...)
+		fh.Modified = e.header.ModTime
+		if fh.Flags&0x1 == 0 || fh.Flags&0x8 == 0 || fh.Method == aesMethod {
+			// Otherwise traditional encryption checks the password
+			// against the MS-DOS time, which must be kept.
+			fh.ModifiedDate, fh.ModifiedTime = msDosTime(e.header.ModTime)
+		}
+		mode := e.header.Mode & modeMask
+		if e.header.IsDir {
+			mode |= fs.ModeDir
+		}
+		fh.SetMode(mode)
+	}
+	fw, err := w.zw.CreateRaw(&fh)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, r)
+
+	return err
+}
+
+// extTimeExtraID is the ID of the extended timestamp extra field.
+const extTimeExtraID = 0x5455
+
+// extTimeExtra returns an extended timestamp extra field storing
+// the modification time t.
+func extTimeExtra(t time.Time) []byte {
+	b := make([]byte, 9)
+	binary.LittleEndian.PutUint16(b, extTimeExtraID)
+	binary.LittleEndian.PutUint16(b[2:], 5)
+	b[4] = 1
+	binary.LittleEndian.PutUint32(b[5:], uint32(t.Unix()))
+
+	return b
+}
+
+// stripExtra returns extra without the fields of the given IDs.
+func stripExtra(extra []byte, ids ...uint16) []byte {
+	var b []byte
+	for len(extra) >= 4 {
+		id, size := binary.LittleEndian.Uint16(extra), int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			break
+		}
+		if !slices.Contains(ids, id) {
+			b = append(b, extra[:4+size]...)
+		}
+		extra = extra[4+size:]
+	}
+
+	return b
+}
+
+// msDosTime returns the MS-DOS date and time of t.
+func msDosTime(t time.Time) (uint16, uint16) {
+	return uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9),
+		uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+}
+
+// incompressible reports whether compressing b saves less than 10%.
+func incompressible(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+
+	var n countWriter
+	fw, _ := flate.NewWriter(&n, flate.BestSpeed)
+	fw.Write(b)
+	fw.Close()
+
+	return int64(n) > int64(len(b))*9/10
+}
+
+type countWriter int64
+
+func (w *countWriter) Write(b []byte) (int, error) {
+	*w += countWriter(len(b))
+	return len(b), nil
+}
+
+func (w *zipWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+
+	return w.zw.Close()
+}
+
+type zipReader struct {
+	zr       *zip.Reader
+	index    int
+	cur      *zip.File // current entry, opened on the first Read
+	rc       io.ReadCloser
+	spool    *os.File
+	password string
+	charset  encoding.Encoding
+	onEvent  func(Event)
+	count    func(*Header) error
+}
+
+// newZipReader uses r directly if it supports random access,
+// otherwise it spools r to a temporary file.
+func newZipReader(r io.Reader, u *Unpacker) (*zipReader, error) {
+	ra, size, ok := sizeReaderAt(r)
+	var spool *os.File
+	if !ok {
+		var err error
+		if spool, err = os.CreateTemp("", "archive-*.zip"); err != nil {
+			return nil, err
+		}
+		if size, err = io.Copy(spool, r); err != nil {
+			removeFile(spool)
+			return nil, err
+		}
+		ra = spool
+	}
+
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		removeFile(spool)
 		return nil, err
 	}
 
-	var fs []File
-	for _, f := range r.File {
-		switch {
-		case f.FileInfo().IsDir():
-			fs = append(fs, File{Name: f.Name, IsDir: true})
-		case f.FileInfo().Mode().IsRegular():
-			rc, err := f.Open()
-			if err != nil {
-				return nil, err
-			}
-			var buf bytes.Buffer
-			if _, err := io.Copy(&buf, rc); err != nil {
-				return nil, err
+	charset := u.Charset
+	if charset == nil {
+		charset = detectCharset(zr.File)
+	}
+
+	return &zipReader{zr: zr, spool: spool, password: u.Password, charset: charset, onEvent: u.OnEvent}, nil
+}
+
+func (r *zipReader) Next() (*Header, error) {
+	if err := r.closeEntry(); err != nil {
+		return nil, err
+	}
+
+	for r.index < len(r.zr.File) {
+		f := r.zr.File[r.index]
+		r.index++
+
+		header, ok, err := r.header(f)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			skip := &Header{Name: zipName(f, r.charset), Size: int64(min(f.UncompressedSize64, math.MaxInt64))}
+			if r.count != nil {
+				if err := r.count(skip); err != nil {
+					return nil, err
+				}
 			}
-			fs = append(fs, File{Name: f.Name, Body: buf.Bytes()})
-			if err := rc.Close(); err != nil {
-				return nil, err
+			if r.onEvent != nil {
+				skipped(r.onEvent, skip, fmt.Sprintf("unknown type %v", f.Mode().Type()))
+				continue
 			}
-		default:
 			log.Printf(
 				"ExtractZip: uknown type: %d in %s",
 				f.FileInfo().Mode(),
 				f.Name)
+			continue
+		}
+		if !header.IsDir && header.Linkname == "" {
+			r.cur = f
 		}
+
+		return header, nil
+	}
+
+	return nil, io.EOF
+}
+
+func (r *zipReader) countSkipped(count func(*Header) error) { r.count = count }
+
+// header returns the Header of f, reading the target of symbolic links.
+// It reports false for unsupported entry types.
+func (r *zipReader) header(f *zip.File) (*Header, bool, error) {
+	mode := f.Mode()
+	header := r.rawHeader(f)
+	switch {
+	case mode.IsDir():
+	case mode&fs.ModeSymlink != 0:
+		rc, err := r.open(f)
+		if err != nil {
+			return nil, false, err
+		}
+		b, err := io.ReadAll(io.LimitReader(rc, maxLinkname))
+		rc.Close()
+		if err != nil {
+			return nil, false, err
+		}
+		header.Linkname = string(b)
+	case mode.IsRegular():
+	default:
+		return nil, false, nil
+	}
+
+	return header, true, nil
+}
+
+// rawHeader returns the header of f read from its metadata only,
+// without the target of a symbolic link.
+func (r *zipReader) rawHeader(f *zip.File) *Header {
+	mode := f.Mode()
+	header := &Header{
+		Name:           zipName(f, r.charset),
+		IsDir:          mode.IsDir(),
+		Mode:           mode & modeMask,
+		ModTime:        f.Modified,
+		CompressedSize: int64(f.CompressedSize64),
+		CRC32:          f.CRC32,
+	}
+	if mode.IsRegular() {
+		header.Size = int64(f.UncompressedSize64)
+	}
+	switch f.Method {
+	case zip.Store:
+		header.Method = Store
+	case zip.Deflate:
+		header.Method = Deflate
+	}
+
+	return header
+}
+
+// open opens the entry f, decrypting it if needed.
+func (r *zipReader) open(f *zip.File) (io.ReadCloser, error) {
+	if f.Flags&0x1 != 0 {
+		return openEncrypted(f, r.password)
+	}
+
+	return f.Open()
+}
+
+func (r *zipReader) Read(b []byte) (int, error) {
+	if r.rc == nil {
+		if r.cur == nil {
+			return 0, io.EOF
+		}
+		rc, err := r.open(r.cur)
+		if err != nil {
+			return 0, err
+		}
+		r.rc = rc
+	}
+
+	return r.rc.Read(b)
+}
+
+func (r *zipReader) closeEntry() error {
+	r.cur = nil
+	if r.rc == nil {
+		return nil
+	}
+	err := r.rc.Close()
+	r.rc = nil
+
+	return err
+}
+
+func (r *zipReader) Close() error {
+	if err := r.closeEntry(); err != nil {
+		removeFile(r.spool)
+		return err
+	}
+
+	return removeFile(r.spool)
+}
+
+func removeFile(f *os.File) error {
+	if f == nil {
+		return nil
 	}
+	f.Close()
 
-	return fs, nil
+	return os.Remove(f.Name())
 }
@@ -1,20 +1,28 @@
 package cache
 
 import (
-	"log"
+	"container/heap"
+	"context"
 	"sync"
 	"time"
 )
 
-type item struct {
-	sync.Mutex
-	Value      interface{}
+type item[K comparable, V any] struct {
+	Value      V
 	Duration   time.Duration
 	Expiration int64
-	Regenerate func() (interface{}, error)
+	Regenerate func() (V, error)
+
+	key   K
+	cost  int64
+	index int // index in the expiry queue, -1 if not in it
+
+	staleSince int64 // when the value expired, 0 if regenerated since
+	failures   uint  // consecutive failed regenerations
+	err        error // last regeneration error
 }
 
-func (i *item) Expired() bool {
+func (i *item[K, V]) Expired() bool {
 	if i.Expiration == 0 {
 		return false
 	}
@@ -22,124 +30,360 @@ func (i *item) Expired() bool {
 	return time.Now().UnixNano() > i.Expiration
 }
 
-// Cache is cache struct.
-type Cache struct {
-	cache     sync.Map
+// Typed is a cache of K keys and V values.
+type Typed[K comparable, V any] struct {
+	mu        sync.Mutex
+	items     map[K]*item[K, V]
 	autoClean bool
+	expiry    expiryQueue[K, V]
+	wake      chan struct{}
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	maxEntries int
+	maxCost    int64
+	cost       func(K, V) int64
+	totalCost  int64
+	policy     Policy
+	evictor    evictor[K]
+
+	onEvicted     func(K, V, EvictionReason)
+	onRegenerated func(K, V)
+	onError       func(K, error)
+	// pending holds the callbacks to call once c.mu is released.
+	pending []func()
+
+	attempts, delay uint
+	backoff         time.Duration
+	maxStale        time.Duration
+
+	calls       map[K]*call[V]
+	negatives   map[K]negative
+	negativeTTL time.Duration
+
+	codec        Codec
+	regenerators map[K]func() (V, error)
+	patterns     []regeneratePattern[K, V]
+	snapshots    sync.WaitGroup
+	snapshotErr  error
 }
 
-// New creates a new cache with auto clean or not.
+// Cache is cache struct, of interface{} keys and values.
+// It is kept for compatibility; use Typed for type-safe keys and values.
+type Cache = Typed[interface{}, interface{}]
+
+// New creates a new cache of interface{} keys and values with auto clean or not.
+// Call Close to stop auto clean when the cache is no longer used.
 func New(autoClean bool) *Cache {
-	c := &Cache{autoClean: autoClean}
+	return NewTyped[interface{}, interface{}](autoClean)
+}
+
+// NewTyped creates a new cache of K keys and V values with auto clean or not.
+// Call Close to stop auto clean when the cache is no longer used.
+func NewTyped[K comparable, V any](autoClean bool) *Typed[K, V] {
+	return NewTypedWithContext[K, V](context.Background(), autoClean)
+}
+
+// NewTypedWithContext creates a new cache of K keys and V values with auto
+// clean or not. Auto clean stops when ctx is done or Close is called.
+func NewTypedWithContext[K comparable, V any](ctx context.Context, autoClean bool) *Typed[K, V] {
+	c := &Typed[K, V]{
+		items:     make(map[K]*item[K, V]),
+		autoClean: autoClean,
+		wake:      make(chan struct{}, 1),
+		calls:     make(map[K]*call[V]),
+		negatives: make(map[K]negative),
 
+		codec:        GobCodec,
+		regenerators: make(map[K]func() (V, error)),
+	}
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
 	if autoClean {
-		go c.check()
+		go c.check(c.ctx)
 	}
 
 	return c
 }
 
-// Set sets cache value for a key, if f is presented, this value will regenerate when expired.
-func (c *Cache) Set(key, value interface{}, d time.Duration, f func() (interface{}, error)) {
-	c.cache.Store(key, &item{
-		Value:      value,
-		Duration:   d,
-		Expiration: time.Now().Add(d).UnixNano(),
-		Regenerate: f,
-	})
+// Close stops auto clean and periodic snapshots, after saving a last one.
+// It returns the error of the last snapshot, if any. The cache stays usable,
+// and expired values are then removed or regenerated when they are got,
+// like without auto clean.
+func (c *Typed[K, V]) Close() error {
+	c.mu.Lock()
+	c.autoClean = false
+	c.unlock()
+	c.cancel()
+	c.snapshots.Wait()
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	return c.snapshotErr
 }
 
-func (c *Cache) regenerate(i *item) {
-	i.Expiration = 0
-	f := i.Regenerate
-	i.Unlock()
+// SetMaxEntries limits the number of values in cache to n, evicting values
+// according to the eviction policy when it is exceeded. Zero means no limit.
+func (c *Typed[K, V]) SetMaxEntries(n int) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
 
-	go func() {
-		value, err := f()
+	c.maxEntries = n
+	c.reset()
 
-		i.Lock()
-		defer i.Unlock()
+	return c
+}
 
-		if err != nil {
-			log.Print(err)
-		} else {
-			i.Value = value
-		}
-		i.Expiration = time.Now().Add(i.Duration).UnixNano()
-	}()
+// SetMaxCost limits the total cost of the values in cache to max, evicting
+// values according to the eviction policy when it is exceeded. The cost of
+// a value is given by cost. Zero means no limit.
+func (c *Typed[K, V]) SetMaxCost(max int64, cost func(K, V) int64) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.maxCost, c.cost = max, cost
+	c.reset()
+
+	return c
 }
 
-// Get gets cache value by key and whether value was found.
-func (c *Cache) Get(key interface{}) (interface{}, bool) {
-	value, ok := c.cache.Load(key)
+// SetPolicy sets the eviction policy of a bounded cache. The default is LRU.
+func (c *Typed[K, V]) SetPolicy(policy Policy) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.policy = policy
+	c.reset()
+
+	return c
+}
+
+// reset recomputes the costs and rebuilds the evictor after the limits or
+// the policy changed, evicting values if needed.
+func (c *Typed[K, V]) reset() {
+	c.evictor, c.totalCost = nil, 0
+	if c.maxEntries <= 0 && c.maxCost <= 0 {
+		return
+	}
+
+	c.evictor = newEvictor[K](c.policy, c.maxEntries)
+	for key, i := range c.items {
+		i.cost = c.costOf(key, i.Value)
+		c.totalCost += i.cost
+		c.evictor.add(key, false)
+	}
+	c.evict()
+}
+
+func (c *Typed[K, V]) costOf(key K, value V) int64 {
+	if c.maxCost <= 0 || c.cost == nil {
+		return 0
+	}
+
+	return c.cost(key, value)
+}
+
+func (c *Typed[K, V]) full() bool {
+	return c.maxEntries > 0 && len(c.items) > c.maxEntries ||
+		c.maxCost > 0 && c.totalCost > c.maxCost
+}
+
+// evict evicts values until the cache is within its limits.
+func (c *Typed[K, V]) evict() {
+	for c.evictor != nil && len(c.items) > 0 && c.full() {
+		c.remove(c.evictor.victim(), Capacity)
+	}
+}
+
+// remove removes the value for a key for reason, with c.mu held.
+func (c *Typed[K, V]) remove(key K, reason EvictionReason) {
+	i, ok := c.items[key]
 	if !ok {
-		return nil, false
+		return
+	}
+
+	delete(c.items, key)
+	c.evicted(key, i.Value, reason)
+	c.unschedule(i)
+	c.totalCost -= i.cost
+	if c.evictor != nil {
+		c.evictor.remove(key)
 	}
+}
 
-	i := value.(*item)
+// Set sets cache value for a key, if f is presented, this value will regenerate when expired.
+// A zero d means the value never expires.
+func (c *Typed[K, V]) Set(key K, value V, d time.Duration, f func() (V, error)) {
+	var expiration int64
+	if d > 0 {
+		expiration = time.Now().Add(d).UnixNano()
+	}
 
-	i.Lock()
-	v := i.Value
-	expired := i.Expired()
-	f := i.Regenerate
+	c.mu.Lock()
+	defer c.unlock()
 
-	if expired && !c.autoClean {
-		if f == nil {
-			c.cache.Delete(key)
-			i.Unlock()
+	c.set(key, value, expiration, d, f)
+}
 
-			return nil, false
+// set sets cache value for a key, with c.mu held.
+func (c *Typed[K, V]) set(key K, value V, expiration int64, d time.Duration, f func() (V, error)) {
+	delete(c.negatives, key)
+	i := &item[K, V]{
+		Value:      value,
+		Duration:   d,
+		Expiration: expiration,
+		Regenerate: f,
+		key:        key,
+		cost:       c.costOf(key, value),
+		index:      -1,
+	}
+	old, ok := c.items[key]
+	if ok {
+		c.unschedule(old)
+		c.totalCost -= old.cost
+		c.evicted(key, old.Value, Replaced)
+	}
+	c.items[key] = i
+	c.schedule(i)
+	c.totalCost += i.cost
+	if c.evictor != nil {
+		if ok {
+			c.evictor.access(key)
+		} else {
+			c.evictor.add(key, c.full())
 		}
+		c.evict()
+	}
+}
 
-		defer c.regenerate(i)
+// Get gets cache value by key and whether value was found.
+func (c *Typed[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	return c.get(key)
+}
 
-		return v, true
+// get gets cache value by key, with c.mu held.
+func (c *Typed[K, V]) get(key K) (V, bool) {
+	i, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
 	}
 
-	i.Unlock()
+	if c.tooStale(i) {
+		c.remove(key, Expired)
+
+		var zero V
+		return zero, false
+	}
+	if i.Expired() && !c.autoClean {
+		if i.Regenerate == nil {
+			c.remove(key, Expired)
+
+			var zero V
+			return zero, false
+		}
+
+		c.regenerate(key, i)
+	}
+	if c.evictor != nil {
+		c.evictor.access(key)
+	}
 
-	return v, true
+	return i.Value, true
 }
 
 // Delete deletes the value for a key.
-func (c *Cache) Delete(key interface{}) {
-	c.cache.Delete(key)
+func (c *Typed[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.remove(key, Deleted)
+	delete(c.negatives, key)
 }
 
 // Empty deletes all values in cache.
-func (c *Cache) Empty() {
-	c.cache.Range(func(key, _ interface{}) bool {
-		c.cache.Delete(key)
-		return true
-	})
+func (c *Typed[K, V]) Empty() {
+	c.mu.Lock()
+	defer c.unlock()
+
+	for key := range c.items {
+		c.remove(key, Emptied)
+	}
+	clear(c.negatives)
 }
 
-func (c *Cache) check() {
-	ticker := time.NewTicker(time.Second)
-	defer ticker.Stop()
+// Len returns the number of values in cache.
+func (c *Typed[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.unlock()
 
-	for range ticker.C {
-		c.cache.Range(func(key, value interface{}) bool {
-			i := value.(*item)
+	return len(c.items)
+}
 
-			i.Lock()
-			expired := i.Expired()
-			f := i.Regenerate
+// schedule adds i to the expiry queue if it expires, with c.mu held.
+func (c *Typed[K, V]) schedule(i *item[K, V]) {
+	if i.Expiration == 0 {
+		return
+	}
 
-			if expired {
-				if f == nil {
-					c.cache.Delete(key)
-					i.Unlock()
-				} else {
-					defer c.regenerate(i)
-				}
+	heap.Push(&c.expiry, i)
+	if i.index == 0 {
+		// Expires first, the check goroutine must wake up earlier.
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+}
 
-				return true
-			}
+// unschedule removes i from the expiry queue, with c.mu held.
+func (c *Typed[K, V]) unschedule(i *item[K, V]) {
+	if i.index >= 0 {
+		heap.Remove(&c.expiry, i.index)
+	}
+}
 
-			i.Unlock()
+// expire removes or regenerates the expired values, with c.mu held.
+// It returns how long until the next value expires.
+func (c *Typed[K, V]) expire() time.Duration {
+	now := time.Now().UnixNano()
+	for len(c.expiry) > 0 {
+		i := c.expiry[0]
+		if i.Expiration >= now {
+			return time.Duration(i.Expiration - now + 1)
+		}
+		if i.Regenerate == nil || c.tooStale(i) {
+			c.remove(i.key, Expired)
+		} else {
+			c.regenerate(i.key, i)
+		}
+	}
+
+	return time.Hour
+}
+
+func (c *Typed[K, V]) check(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			c.autoClean = false
+			c.unlock()
+			return
+		case <-timer.C:
+		case <-c.wake:
+		}
 
-			return true
-		})
+		c.mu.Lock()
+		next := c.expire()
+		c.unlock()
+		timer.Reset(next)
 	}
 }
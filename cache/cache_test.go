@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"context"
 	"testing"
 	"time"
 )
@@ -70,8 +71,10 @@ func TestAutoCleanRegenerate(t *testing.T) {
 		}
 	}
 
+	// Check halfway between regenerations.
+	time.Sleep(time.Second)
 	for _, i := range newValue {
-		time.Sleep(3 * time.Second)
+		time.Sleep(2 * time.Second)
 
 		_, ok := cache.Get("expire")
 		if ok {
@@ -86,3 +89,70 @@ func TestAutoCleanRegenerate(t *testing.T) {
 		}
 	}
 }
+
+func TestAutoCleanExpiry(t *testing.T) {
+	cache := NewTyped[int, int](true)
+	defer cache.Close()
+
+	cache.Set(0, 0, 0, nil)
+	for i := 1; i <= 100; i++ {
+		cache.Set(i, i, time.Duration(100+i)*time.Millisecond, nil)
+	}
+	// Expires before all others, so auto clean must wake up earlier.
+	cache.Set(-1, -1, 10*time.Millisecond, nil)
+
+	time.Sleep(50 * time.Millisecond)
+	if n := cache.Len(); n != 101 {
+		t.Errorf("expected 101; got %d", n)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if n := cache.Len(); n != 1 {
+		t.Errorf("expected 1; got %d", n)
+	}
+}
+
+func TestClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	closed := NewTyped[string, string](true)
+	canceled := NewTypedWithContext[string, string](ctx, true)
+
+	closed.Close()
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+
+	for _, cache := range []*Typed[string, string]{closed, canceled} {
+		cache.Set("key", "value", 10*time.Millisecond, nil)
+		time.Sleep(50 * time.Millisecond)
+		if n := cache.Len(); n != 1 {
+			t.Errorf("expected no auto clean; got %d values", n)
+		}
+		// Expired values are still removed when got.
+		if _, ok := cache.Get("key"); ok {
+			t.Error("expected not ok; got ok")
+		}
+	}
+}
+
+func TestTyped(t *testing.T) {
+	cache := NewTyped[int, string](false)
+
+	cache.Set(1, "one", 0, nil)
+	cache.Set(2, "two", time.Millisecond, func() (string, error) {
+		return "three", nil
+	})
+
+	var value string
+	value, ok := cache.Get(1)
+	if !ok || value != "one" {
+		t.Errorf("expected one; got %q", value)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if value, ok := cache.Get(2); !ok || value != "two" {
+		t.Errorf("expected stale two; got %q", value)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if value, ok := cache.Get(2); !ok || value != "three" {
+		t.Errorf("expected regenerated three; got %q", value)
+	}
+}
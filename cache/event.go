@@ -0,0 +1,83 @@
+package cache
+
+// EvictionReason is why a value left the cache.
+type EvictionReason int
+
+const (
+	// Expired means the value expired without a regenerate function.
+	Expired EvictionReason = iota
+	// Capacity means the value was evicted to keep the cache within its limits.
+	Capacity
+	// Deleted means the value was deleted by Delete.
+	Deleted
+	// Emptied means the value was deleted by Empty.
+	Emptied
+	// Replaced means the value was replaced by Set or by a regenerated value.
+	Replaced
+)
+
+func (r EvictionReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case Capacity:
+		return "capacity"
+	case Deleted:
+		return "deleted"
+	case Emptied:
+		return "emptied"
+	case Replaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// OnEvicted sets f to be called with the key, the value and the reason
+// whenever a value leaves the cache, for example to close a resource it
+// holds. f is called without any lock of the cache held, so it may use it.
+func (c *Typed[K, V]) OnEvicted(f func(key K, value V, reason EvictionReason)) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.onEvicted = f
+
+	return c
+}
+
+// OnRegenerated sets f to be called with the key and the new value
+// whenever a value is regenerated. f is called without any lock of
+// the cache held, so it may use it.
+func (c *Typed[K, V]) OnRegenerated(f func(key K, value V)) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.onRegenerated = f
+
+	return c
+}
+
+// evicted queues a call to the OnEvicted callback, with c.mu held.
+func (c *Typed[K, V]) evicted(key K, value V, reason EvictionReason) {
+	if f := c.onEvicted; f != nil {
+		c.pending = append(c.pending, func() { f(key, value, reason) })
+	}
+}
+
+// regenerated queues a call to the OnRegenerated callback, with c.mu held.
+func (c *Typed[K, V]) regenerated(key K, value V) {
+	if f := c.onRegenerated; f != nil {
+		c.pending = append(c.pending, func() { f(key, value) })
+	}
+}
+
+// unlock releases c.mu, then calls the queued callbacks.
+func (c *Typed[K, V]) unlock() {
+	pending := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	for _, f := range pending {
+		f()
+	}
+}
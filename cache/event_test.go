@@ -0,0 +1,111 @@
+package cache
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOnEvicted(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	cache := NewTyped[string, int](false).SetMaxEntries(2)
+	cache.OnEvicted(func(key string, value int, reason EvictionReason) {
+		// The cache is usable from the callback.
+		cache.Len()
+
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, fmt.Sprintf("%s=%d %s", key, value, reason))
+	})
+
+	cache.Set("a", 1, 0, nil)
+	cache.Set("a", 2, 0, nil)
+	cache.Set("b", 3, 0, nil)
+	cache.Set("c", 4, 0, nil)
+	cache.Delete("b")
+	cache.Set("d", 5, time.Millisecond, nil)
+	time.Sleep(10 * time.Millisecond)
+	cache.Get("d")
+	cache.Empty()
+
+	expected := []string{
+		"a=1 replaced",
+		"a=2 capacity",
+		"b=3 deleted",
+		"d=5 expired",
+		"c=4 emptied",
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(events, expected) {
+		t.Errorf("expected %q; got %q", expected, events)
+	}
+}
+
+func TestOnEvictedAutoClean(t *testing.T) {
+	evicted := make(chan string, 1)
+	cache := NewTyped[string, string](true).OnEvicted(func(key string, _ string, reason EvictionReason) {
+		if reason != Expired {
+			t.Errorf("expected expired; got %s", reason)
+		}
+		evicted <- key
+	})
+	defer cache.Close()
+
+	cache.Set("key", "value", 10*time.Millisecond, nil)
+	select {
+	case key := <-evicted:
+		if key != "key" {
+			t.Errorf("expected key; got %q", key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no eviction")
+	}
+}
+
+func TestOnRegenerated(t *testing.T) {
+	regenerated := make(chan int, 1)
+	replaced := make(chan int, 1)
+	cache := NewTyped[string, int](true)
+	cache.OnEvicted(func(_ string, value int, reason EvictionReason) {
+		if reason != Replaced {
+			t.Errorf("expected replaced; got %s", reason)
+		}
+		select {
+		case replaced <- value:
+		default:
+		}
+	})
+	cache.OnRegenerated(func(key string, value int) {
+		if v, _ := cache.Get(key); v != value {
+			t.Errorf("expected %d; got %d", value, v)
+		}
+		select {
+		case regenerated <- value:
+		default:
+		}
+	})
+	defer cache.Close()
+
+	cache.Set("key", 1, 10*time.Millisecond, func() (int, error) { return 2, nil })
+	select {
+	case value := <-regenerated:
+		if value != 2 {
+			t.Errorf("expected 2; got %d", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no regeneration")
+	}
+	// The previous value is evicted, so its resources can be released.
+	select {
+	case value := <-replaced:
+		if value != 1 {
+			t.Errorf("expected 1; got %d", value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no eviction")
+	}
+}
@@ -0,0 +1,32 @@
+package cache
+
+// expiryQueue is a min-heap of the expiring items ordered by expiration,
+// so that auto clean only visits the items due.
+type expiryQueue[K comparable, V any] []*item[K, V]
+
+func (q expiryQueue[K, V]) Len() int { return len(q) }
+
+func (q expiryQueue[K, V]) Less(i, j int) bool { return q[i].Expiration < q[j].Expiration }
+
+func (q expiryQueue[K, V]) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *expiryQueue[K, V]) Push(x interface{}) {
+	i := x.(*item[K, V])
+	i.index = len(*q)
+	*q = append(*q, i)
+}
+
+func (q *expiryQueue[K, V]) Pop() interface{} {
+	old := *q
+	n := len(old)
+	i := old[n-1]
+	old[n-1] = nil
+	i.index = -1
+	*q = old[:n-1]
+
+	return i
+}
@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// call is a load in progress or completed.
+type call[V any] struct {
+	done    chan struct{}
+	value   V
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// negative is a cached loader error.
+type negative struct {
+	err        error
+	expiration int64
+}
+
+// SetNegativeTTL makes GetOrLoad cache loader errors for d, returning them
+// without loading again until they expire. Zero, the default, disables it.
+func (c *Typed[K, V]) SetNegativeTTL(d time.Duration) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.negativeTTL = d
+	if d <= 0 {
+		clear(c.negatives)
+	}
+
+	return c
+}
+
+// GetOrLoad gets cache value by key. If the value is missing, it is loaded
+// by loader and set with duration d. Concurrent calls for the same key share
+// a single load, and all of them get its value or error.
+//
+// If ctx is done before the value is loaded, GetOrLoad returns ctx.Err().
+// The context passed to loader keeps the values of ctx and is canceled
+// once every caller waiting for the load gave up.
+func (c *Typed[K, V]) GetOrLoad(
+	ctx context.Context,
+	key K,
+	d time.Duration,
+	loader func(context.Context) (V, error),
+) (V, error) {
+	c.mu.Lock()
+	if value, ok := c.get(key); ok {
+		c.unlock()
+		return value, nil
+	}
+	if n, ok := c.negatives[key]; ok {
+		if time.Now().UnixNano() <= n.expiration {
+			c.unlock()
+			var zero V
+			return zero, n.err
+		}
+		delete(c.negatives, key)
+	}
+
+	cl, ok := c.calls[key]
+	if !ok {
+		lctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		cl = &call[V]{done: make(chan struct{}), cancel: cancel}
+		c.calls[key] = cl
+		go c.load(lctx, key, d, cl, loader)
+	}
+	cl.waiters++
+	c.unlock()
+
+	select {
+	case <-cl.done:
+		return cl.value, cl.err
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	if cl.waiters--; cl.waiters == 0 {
+		// Nobody waits for the load anymore.
+		cl.cancel()
+		if c.calls[key] == cl {
+			delete(c.calls, key)
+		}
+	}
+	c.unlock()
+
+	var zero V
+	return zero, ctx.Err()
+}
+
+func (c *Typed[K, V]) load(
+	ctx context.Context,
+	key K,
+	d time.Duration,
+	cl *call[V],
+	loader func(context.Context) (V, error),
+) {
+	defer cl.cancel()
+
+	value, err := loader(ctx)
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	cl.value, cl.err = value, err
+	close(cl.done)
+	if c.calls[key] != cl {
+		// Abandoned by all callers.
+		return
+	}
+	delete(c.calls, key)
+
+	if err != nil {
+		if c.negativeTTL > 0 && ctx.Err() == nil {
+			c.negatives[key] = negative{err, time.Now().Add(c.negativeTTL).UnixNano()}
+		}
+		return
+	}
+	if _, ok := c.items[key]; ok {
+		// Set meanwhile.
+		return
+	}
+	var expiration int64
+	if d > 0 {
+		expiration = time.Now().Add(d).UnixNano()
+	}
+	c.set(key, value, expiration, d, nil)
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrLoad(t *testing.T) {
+	cache := NewTyped[string, string](false)
+
+	var calls atomic.Int32
+	loader := func(context.Context) (string, error) {
+		calls.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		return "value", nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := cache.GetOrLoad(context.Background(), "key", 0, loader); err != nil {
+				t.Error(err)
+			} else if value != "value" {
+				t.Errorf("expected %q; got %q", "value", value)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected 1 load; got %d", n)
+	}
+
+	if value, ok := cache.Get("key"); !ok || value != "value" {
+		t.Errorf("expected %q, true; got %q, %v", "value", value, ok)
+	}
+	if _, err := cache.GetOrLoad(context.Background(), "key", 0, loader); err != nil {
+		t.Error(err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected 1 load; got %d", n)
+	}
+}
+
+func TestGetOrLoadError(t *testing.T) {
+	cache := NewTyped[string, string](false)
+
+	errLoad := errors.New("load error")
+	var calls atomic.Int32
+	loader := func(context.Context) (string, error) {
+		calls.Add(1)
+		time.Sleep(100 * time.Millisecond)
+		return "", errLoad
+	}
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.GetOrLoad(context.Background(), "key", 0, loader); err != errLoad {
+				t.Errorf("expected %v; got %v", errLoad, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected 1 load; got %d", n)
+	}
+
+	// Errors are not cached by default.
+	cache.GetOrLoad(context.Background(), "key", 0, loader)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 loads; got %d", n)
+	}
+	if _, ok := cache.Get("key"); ok {
+		t.Error("expected not ok; got ok")
+	}
+}
+
+func TestNegativeTTL(t *testing.T) {
+	cache := NewTyped[string, string](false).SetNegativeTTL(200 * time.Millisecond)
+
+	errLoad := errors.New("load error")
+	var calls atomic.Int32
+	loader := func(context.Context) (string, error) {
+		calls.Add(1)
+		return "", errLoad
+	}
+
+	for range 3 {
+		if _, err := cache.GetOrLoad(context.Background(), "key", 0, loader); err != errLoad {
+			t.Errorf("expected %v; got %v", errLoad, err)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected 1 load; got %d", n)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	cache.GetOrLoad(context.Background(), "key", 0, loader)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("expected 2 loads; got %d", n)
+	}
+
+	// Set replaces a cached error.
+	cache.Set("key", "value", 0, nil)
+	if value, err := cache.GetOrLoad(context.Background(), "key", 0, loader); err != nil || value != "value" {
+		t.Errorf("expected %q, nil; got %q, %v", "value", value, err)
+	}
+}
+
+func TestGetOrLoadCancel(t *testing.T) {
+	cache := NewTyped[string, string](false)
+
+	canceled := make(chan struct{})
+	loader := func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		close(canceled)
+		return "", ctx.Err()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := cache.GetOrLoad(ctx, "key", 0, loader); err != context.Canceled {
+		t.Errorf("expected %v; got %v", context.Canceled, err)
+	}
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("loader not canceled")
+	}
+
+	// A new call loads again.
+	value, err := cache.GetOrLoad(context.Background(), "key", 0, func(context.Context) (string, error) {
+		return "value", nil
+	})
+	if err != nil || value != "value" {
+		t.Errorf("expected %q, nil; got %q, %v", "value", value, err)
+	}
+}
@@ -0,0 +1,234 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Codec encodes and decodes cache snapshots.
+type Codec interface {
+	Encode(w io.Writer, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+var (
+	// GobCodec encodes snapshots with encoding/gob. It is the default.
+	// Concrete types stored in interface{} keys or values must be
+	// registered with gob.Register.
+	GobCodec Codec = gobCodec{}
+	// JSONCodec encodes snapshots with encoding/json.
+	// interface{} keys and values are restored as their JSON types.
+	JSONCodec Codec = jsonCodec{}
+)
+
+type gobCodec struct{}
+
+func (gobCodec) Encode(w io.Writer, v interface{}) error { return gob.NewEncoder(w).Encode(v) }
+func (gobCodec) Decode(r io.Reader, v interface{}) error { return gob.NewDecoder(r).Decode(v) }
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(w io.Writer, v interface{}) error { return json.NewEncoder(w).Encode(v) }
+func (jsonCodec) Decode(r io.Reader, v interface{}) error { return json.NewDecoder(r).Decode(v) }
+
+// entry is a saved value.
+type entry[K comparable, V any] struct {
+	Key      K
+	Value    V
+	Duration time.Duration
+	// TTL is the time left before the value expires,
+	// 0 if it never expires and -1 if it expired.
+	TTL time.Duration
+}
+
+type regeneratePattern[K comparable, V any] struct {
+	pattern string
+	f       func(K) (V, error)
+}
+
+// SetCodec sets the codec of Save and Load.
+func (c *Typed[K, V]) SetCodec(codec Codec) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.codec = codec
+
+	return c
+}
+
+// RegisterRegenerate registers f as the regenerate function of the value
+// for a key restored by Load.
+func (c *Typed[K, V]) RegisterRegenerate(key K, f func() (V, error)) {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.regenerators[key] = f
+}
+
+// RegisterRegeneratePattern registers f as the regenerate function of the
+// values restored by Load whose key, formatted with fmt.Sprint, matches
+// pattern, as in path.Match. f is called with the key. Keys registered with
+// RegisterRegenerate take precedence, then patterns in registration order.
+func (c *Typed[K, V]) RegisterRegeneratePattern(pattern string, f func(K) (V, error)) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.patterns = append(c.patterns, regeneratePattern[K, V]{pattern, f})
+
+	return nil
+}
+
+// regenerator returns the registered regenerate function for a key,
+// with c.mu held.
+func (c *Typed[K, V]) regenerator(key K) func() (V, error) {
+	if f, ok := c.regenerators[key]; ok {
+		return f
+	}
+
+	name := fmt.Sprint(key)
+	for _, p := range c.patterns {
+		if ok, _ := path.Match(p.pattern, name); ok {
+			return func() (V, error) { return p.f(key) }
+		}
+	}
+
+	return nil
+}
+
+// Save writes the values in cache and their remaining durations to w,
+// encoded with the codec. Regenerate functions are not saved. Expired
+// values are only saved if they regenerate, to be regenerated once loaded.
+func (c *Typed[K, V]) Save(w io.Writer) error {
+	c.mu.Lock()
+	now := time.Now().UnixNano()
+	entries := make([]entry[K, V], 0, len(c.items))
+	for key, i := range c.items {
+		e := entry[K, V]{Key: key, Value: i.Value, Duration: i.Duration}
+		switch {
+		case i.Expiration == 0 && i.staleSince == 0:
+		case i.Expiration > now:
+			e.TTL = time.Duration(i.Expiration - now)
+		case i.Regenerate != nil:
+			e.TTL = -1
+		default:
+			continue
+		}
+		entries = append(entries, e)
+	}
+	codec := c.codec
+	c.unlock()
+
+	return codec.Encode(w, entries)
+}
+
+// Load reads values saved by Save from r and sets them in cache with their
+// remaining durations. Their regenerate functions are the registered ones,
+// see RegisterRegenerate and RegisterRegeneratePattern. Expired values
+// without one are left out, the others are regenerated.
+func (c *Typed[K, V]) Load(r io.Reader) error {
+	c.mu.Lock()
+	codec := c.codec
+	c.unlock()
+
+	var entries []entry[K, V]
+	if err := codec.Decode(r, &entries); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.unlock()
+
+	now := time.Now()
+	for _, e := range entries {
+		f := c.regenerator(e.Key)
+		var expiration int64
+		switch {
+		case e.TTL > 0:
+			expiration = now.Add(e.TTL).UnixNano()
+		case e.TTL < 0:
+			if f == nil {
+				continue
+			}
+			expiration = now.UnixNano() - 1
+		}
+		c.set(e.Key, e.Value, expiration, e.Duration, f)
+	}
+
+	return nil
+}
+
+// SaveFile saves the cache to the named file like Save. The file is
+// replaced atomically, so that it always holds a complete snapshot.
+func (c *Typed[K, V]) SaveFile(name string) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := c.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), name)
+}
+
+// LoadFile loads the cache from the named file like Load.
+// A missing file gives an error wrapping fs.ErrNotExist.
+func (c *Typed[K, V]) LoadFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return c.Load(f)
+}
+
+// Snapshot saves the cache to the named file every interval, and once more
+// when the cache is closed. Errors are logged, except the last one which
+// is returned by Close. If interval is not positive, the cache is only
+// saved when closed.
+func (c *Typed[K, V]) Snapshot(name string, interval time.Duration) {
+	c.snapshots.Add(1)
+	go func() {
+		defer c.snapshots.Done()
+
+		var tick <-chan time.Time
+		if interval > 0 {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+
+		for {
+			select {
+			case <-c.ctx.Done():
+				err := c.SaveFile(name)
+				c.mu.Lock()
+				c.snapshotErr = err
+				c.unlock()
+				return
+			case <-tick:
+				if err := c.SaveFile(name); err != nil {
+					log.Print(err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSaveLoad(t *testing.T) {
+	for _, codec := range []Codec{GobCodec, JSONCodec} {
+		src := NewTyped[string, int](false).SetCodec(codec)
+		src.Set("forever", 1, 0, nil)
+		src.Set("short", 2, 100*time.Millisecond, nil)
+		src.Set("long", 3, time.Hour, nil)
+		src.Set("expired", 4, time.Millisecond, nil)
+		time.Sleep(10 * time.Millisecond)
+
+		var buf bytes.Buffer
+		if err := src.Save(&buf); err != nil {
+			t.Fatal(err)
+		}
+		dst := NewTyped[string, int](false).SetCodec(codec)
+		if err := dst.Load(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		if n := dst.Len(); n != 3 {
+			t.Errorf("expected 3; got %d", n)
+		}
+		for key, expected := range map[string]int{"forever": 1, "short": 2, "long": 3} {
+			if value, ok := dst.Get(key); !ok || value != expected {
+				t.Errorf("expected %d; got %d", expected, value)
+			}
+		}
+
+		// The remaining duration is kept.
+		time.Sleep(100 * time.Millisecond)
+		if _, ok := dst.Get("short"); ok {
+			t.Error("expected not ok; got ok")
+		}
+		if _, ok := dst.Get("long"); !ok {
+			t.Error("expected ok; got not")
+		}
+	}
+}
+
+func TestLoadRegenerate(t *testing.T) {
+	src := NewTyped[string, string](false)
+	regenerate := func() (string, error) { return "", errRegenerate }
+	src.Set("user:1", "one", time.Millisecond, regenerate)
+	src.Set("user:2", "two", time.Hour, regenerate)
+	src.Set("token", "old", time.Millisecond, regenerate)
+	src.Set("other", "value", time.Millisecond, regenerate)
+	time.Sleep(10 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := src.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dst := NewTyped[string, string](false)
+	if err := dst.RegisterRegeneratePattern("[", nil); err == nil {
+		t.Error("expected bad pattern error; got nil")
+	}
+	if err := dst.RegisterRegeneratePattern("user:*", func(key string) (string, error) {
+		return "new " + key, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	dst.RegisterRegenerate("token", func() (string, error) { return "new", nil })
+	if err := dst.Load(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// Expired values without a regenerate function are left out.
+	if _, ok := dst.Get("other"); ok {
+		t.Error("expected not ok; got ok")
+	}
+	for key, expected := range map[string]string{"user:1": "one", "user:2": "two", "token": "old"} {
+		if value, ok := dst.Get(key); !ok || value != expected {
+			t.Errorf("expected %q; got %q", expected, value)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	for key, expected := range map[string]string{"user:1": "new user:1", "user:2": "two", "token": "new"} {
+		if value, ok := dst.Get(key); !ok || value != expected {
+			t.Errorf("expected %q; got %q", expected, value)
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cache")
+
+	src := NewTyped[string, string](true)
+	src.Snapshot(name, 10*time.Millisecond)
+	src.Set("key", "value", time.Hour, nil)
+	time.Sleep(50 * time.Millisecond)
+
+	dst := NewTyped[string, string](false)
+	if err := dst.LoadFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := dst.Get("key"); !ok || value != "value" {
+		t.Errorf("expected value; got %q", value)
+	}
+
+	// A last snapshot is saved on close.
+	src.Set("last", "value", 0, nil)
+	if err := src.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.LoadFile(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := dst.Get("last"); !ok {
+		t.Error("expected ok; got not")
+	}
+}
+
+func TestSnapshotOnClose(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "cache")
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		src := NewTyped[string, string](false)
+		src.Snapshot(name, interval)
+		src.Set("key", "value", 0, nil)
+		time.Sleep(10 * time.Millisecond)
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%v: expected no snapshot before close; got %v", interval, err)
+		}
+
+		if err := src.Close(); err != nil {
+			t.Fatal(err)
+		}
+		dst := NewTyped[string, string](false)
+		if err := dst.LoadFile(name); err != nil {
+			t.Fatal(err)
+		}
+		if value, ok := dst.Get("key"); !ok || value != "value" {
+			t.Errorf("%v: expected value; got %q", interval, value)
+		}
+		os.Remove(name)
+	}
+}
@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"container/heap"
+	"container/list"
+)
+
+// Policy is the eviction policy of a bounded cache.
+type Policy int
+
+const (
+	// LRU evicts the least recently used value.
+	LRU Policy = iota
+	// LFU evicts the least frequently used value,
+	// the least recently used one among equals.
+	LFU
+	// WTinyLFU admits values into a segmented LRU cache only if they are
+	// used more frequently than the value they would evict, as estimated by
+	// a compact frequency sketch. A small LRU window in front of it lets
+	// new values build up their frequency. It resists scans well.
+	WTinyLFU
+)
+
+// evictor tracks the usage of the keys of a bounded cache.
+type evictor[K comparable] interface {
+	// add records a new key. full reports whether the cache is over its limits.
+	add(key K, full bool)
+	// access records a use of key.
+	access(key K)
+	// remove forgets key.
+	remove(key K)
+	// victim returns the key to evict.
+	victim() K
+}
+
+func newEvictor[K comparable](policy Policy, capacity int) evictor[K] {
+	switch policy {
+	case LFU:
+		return &lfu[K]{index: make(map[K]*lfuEntry[K])}
+	case WTinyLFU:
+		return newTinyLFU[K](capacity)
+	default:
+		return &lru[K]{ll: list.New(), elems: make(map[K]*list.Element)}
+	}
+}
+
+type lru[K comparable] struct {
+	ll    *list.List
+	elems map[K]*list.Element
+}
+
+func (p *lru[K]) add(key K, _ bool) {
+	p.elems[key] = p.ll.PushFront(key)
+}
+
+func (p *lru[K]) access(key K) {
+	if e, ok := p.elems[key]; ok {
+		p.ll.MoveToFront(e)
+	}
+}
+
+func (p *lru[K]) remove(key K) {
+	if e, ok := p.elems[key]; ok {
+		p.ll.Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lru[K]) victim() K {
+	return p.ll.Back().Value.(K)
+}
+
+type lfuEntry[K comparable] struct {
+	key   K
+	freq  int
+	tick  int64
+	index int
+}
+
+// lfu is a min-heap of the keys ordered by frequency, then by last use.
+type lfu[K comparable] struct {
+	entries []*lfuEntry[K]
+	index   map[K]*lfuEntry[K]
+	tick    int64
+}
+
+func (p *lfu[K]) Len() int { return len(p.entries) }
+func (p *lfu[K]) Less(i, j int) bool {
+	if p.entries[i].freq != p.entries[j].freq {
+		return p.entries[i].freq < p.entries[j].freq
+	}
+	return p.entries[i].tick < p.entries[j].tick
+}
+func (p *lfu[K]) Swap(i, j int) {
+	p.entries[i], p.entries[j] = p.entries[j], p.entries[i]
+	p.entries[i].index, p.entries[j].index = i, j
+}
+func (p *lfu[K]) Push(x interface{}) {
+	e := x.(*lfuEntry[K])
+	e.index = len(p.entries)
+	p.entries = append(p.entries, e)
+}
+func (p *lfu[K]) Pop() interface{} {
+	e := p.entries[len(p.entries)-1]
+	p.entries = p.entries[:len(p.entries)-1]
+	return e
+}
+
+func (p *lfu[K]) add(key K, _ bool) {
+	p.tick++
+	e := &lfuEntry[K]{key: key, freq: 1, tick: p.tick}
+	p.index[key] = e
+	heap.Push(p, e)
+}
+
+func (p *lfu[K]) access(key K) {
+	if e, ok := p.index[key]; ok {
+		p.tick++
+		e.freq++
+		e.tick = p.tick
+		heap.Fix(p, e.index)
+	}
+}
+
+func (p *lfu[K]) remove(key K) {
+	if e, ok := p.index[key]; ok {
+		heap.Remove(p, e.index)
+		delete(p.index, key)
+	}
+}
+
+func (p *lfu[K]) victim() K {
+	return p.entries[0].key
+}
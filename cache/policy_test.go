@@ -0,0 +1,102 @@
+package cache
+
+import "testing"
+
+func TestLRU(t *testing.T) {
+	cache := NewTyped[string, int](false).SetMaxEntries(3)
+
+	cache.Set("a", 1, 0, nil)
+	cache.Set("b", 2, 0, nil)
+	cache.Set("c", 3, 0, nil)
+	cache.Get("a")
+	cache.Set("d", 4, 0, nil)
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected b evicted; got ok")
+	}
+	for _, i := range []string{"a", "c", "d"} {
+		if _, ok := cache.Get(i); !ok {
+			t.Errorf("expected %s ok; got not", i)
+		}
+	}
+	if n := cache.Len(); n != 3 {
+		t.Errorf("expected 3; got %d", n)
+	}
+}
+
+func TestLFU(t *testing.T) {
+	cache := NewTyped[string, int](false).SetMaxEntries(3).SetPolicy(LFU)
+
+	cache.Set("a", 1, 0, nil)
+	cache.Set("b", 2, 0, nil)
+	cache.Set("c", 3, 0, nil)
+	cache.Get("a")
+	cache.Get("a")
+	cache.Get("b")
+	cache.Set("d", 4, 0, nil)
+
+	if _, ok := cache.Get("c"); ok {
+		t.Error("expected c evicted; got ok")
+	}
+	for _, i := range []string{"a", "b", "d"} {
+		if _, ok := cache.Get(i); !ok {
+			t.Errorf("expected %s ok; got not", i)
+		}
+	}
+}
+
+func TestMaxCost(t *testing.T) {
+	cache := NewTyped[string, string](false).SetMaxCost(10, func(_, value string) int64 {
+		return int64(len(value))
+	})
+
+	cache.Set("a", "1234", 0, nil)
+	cache.Set("b", "1234", 0, nil)
+	cache.Set("c", "1234", 0, nil)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("expected a evicted; got ok")
+	}
+
+	// Replacing a value updates its cost.
+	cache.Set("b", "12", 0, nil)
+	cache.Set("d", "1234", 0, nil)
+	if n := cache.Len(); n != 3 {
+		t.Errorf("expected 3; got %d", n)
+	}
+
+	// A value costing more than the limit is not kept.
+	cache.Set("e", "12345678901", 0, nil)
+	if _, ok := cache.Get("e"); ok {
+		t.Error("expected e evicted; got ok")
+	}
+}
+
+func TestWTinyLFU(t *testing.T) {
+	hits := func(policy Policy) (n int) {
+		cache := NewTyped[int, int](false).SetMaxEntries(100).SetPolicy(policy)
+		for round := 0; round < 10; round++ {
+			for i := 0; i < 50; i++ {
+				if _, ok := cache.Get(i); !ok {
+					cache.Set(i, i, 0, nil)
+				}
+			}
+		}
+		// A scan of keys used only once.
+		for i := 1000; i < 2000; i++ {
+			cache.Set(i, i, 0, nil)
+		}
+		for i := 0; i < 50; i++ {
+			if _, ok := cache.Get(i); ok {
+				n++
+			}
+		}
+		return
+	}
+
+	if n := hits(LRU); n != 0 {
+		t.Errorf("LRU: expected no hit after scan; got %d", n)
+	}
+	if n := hits(WTinyLFU); n < 45 {
+		t.Errorf("WTinyLFU: expected hot keys to survive scan; got %d hits", n)
+	}
+}
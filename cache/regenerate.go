@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"log"
+	"time"
+
+	"github.com/sunshineplan/utils"
+)
+
+// SetRetry makes a failed regenerate function be retried with utils.Retry,
+// up to attempts times in all and waiting delay seconds between tries.
+func (c *Typed[K, V]) SetRetry(attempts, delay uint) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.attempts, c.delay = attempts, delay
+
+	return c
+}
+
+// SetBackoff sets how long to wait before regenerating a value again after
+// its regeneration failed. The wait doubles after each further failure, up
+// to the duration of the value. Zero, the default, means the duration.
+func (c *Typed[K, V]) SetBackoff(d time.Duration) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.backoff = d
+
+	return c
+}
+
+// SetMaxStale limits how long an expired value is still got while it fails
+// to regenerate. After that, it is removed and Get reports a miss.
+// Zero, the default, means no limit.
+func (c *Typed[K, V]) SetMaxStale(d time.Duration) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.maxStale = d
+
+	return c
+}
+
+// OnRegenerateError sets f to be called with the key and the error whenever
+// a value fails to regenerate, instead of logging the error. f is called
+// without any lock of the cache held, so it may use it.
+func (c *Typed[K, V]) OnRegenerateError(f func(key K, err error)) *Typed[K, V] {
+	c.mu.Lock()
+	defer c.unlock()
+
+	c.onError = f
+
+	return c
+}
+
+// RegenerateError returns the error of the last regeneration of the value
+// for a key, or nil if it succeeded or the key is not found.
+func (c *Typed[K, V]) RegenerateError(key K) error {
+	c.mu.Lock()
+	defer c.unlock()
+
+	if i, ok := c.items[key]; ok {
+		return i.err
+	}
+
+	return nil
+}
+
+func (c *Typed[K, V]) regenerate(key K, i *item[K, V]) {
+	if i.staleSince == 0 {
+		i.staleSince = i.Expiration
+	}
+	i.Expiration = 0
+	c.unschedule(i)
+	f, attempts, delay := i.Regenerate, max(c.attempts, 1), c.delay
+
+	go func() {
+		var value V
+		err := utils.Retry(func() (err error) {
+			value, err = f()
+			return
+		}, attempts, delay)
+
+		c.mu.Lock()
+		defer c.unlock()
+
+		if c.items[key] != i {
+			// The value was deleted or replaced meanwhile.
+			return
+		}
+
+		i.err = err
+		if err != nil {
+			i.failures++
+			if f := c.onError; f != nil {
+				c.pending = append(c.pending, func() { f(key, err) })
+			} else {
+				log.Print(err)
+			}
+			i.Expiration = c.retryAt(i)
+		} else {
+			c.evicted(key, i.Value, Replaced)
+			i.Value = value
+			c.totalCost -= i.cost
+			i.cost = c.costOf(key, value)
+			c.totalCost += i.cost
+			i.staleSince, i.failures = 0, 0
+			c.regenerated(key, value)
+			i.Expiration = time.Now().Add(i.Duration).UnixNano()
+		}
+		c.schedule(i)
+		c.evict()
+	}()
+}
+
+// retryAt returns when to regenerate i again after it failed, with c.mu held.
+func (c *Typed[K, V]) retryAt(i *item[K, V]) int64 {
+	wait := i.Duration
+	if c.backoff > 0 {
+		wait = c.backoff
+		for n := i.failures; n > 1 && wait < i.Duration; n-- {
+			wait *= 2
+		}
+		wait = min(wait, i.Duration)
+	}
+
+	at := time.Now().Add(wait).UnixNano()
+	if c.maxStale > 0 {
+		// Be removed on time.
+		at = min(at, i.staleSince+int64(c.maxStale)+1)
+	}
+
+	return at
+}
+
+// tooStale reports whether i expired longer than the max stale ago,
+// with c.mu held.
+func (c *Typed[K, V]) tooStale(i *item[K, V]) bool {
+	return c.maxStale > 0 && i.staleSince > 0 &&
+		time.Now().UnixNano() > i.staleSince+int64(c.maxStale)
+}
@@ -0,0 +1,126 @@
+package cache
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errRegenerate = errors.New("regenerate error")
+
+func TestRetry(t *testing.T) {
+	cache := NewTyped[string, string](false).SetRetry(3, 0)
+
+	var calls atomic.Int32
+	cache.Set("key", "old", 10*time.Millisecond, func() (string, error) {
+		if calls.Add(1) < 3 {
+			return "", errRegenerate
+		}
+		return "new", nil
+	})
+
+	time.Sleep(20 * time.Millisecond)
+	cache.Get("key")
+	time.Sleep(20 * time.Millisecond)
+	if value, ok := cache.Get("key"); !ok || value != "new" {
+		t.Errorf("expected new; got %q", value)
+	}
+	if n := calls.Load(); n != 3 {
+		t.Errorf("expected 3 calls; got %d", n)
+	}
+	if err := cache.RegenerateError("key"); err != nil {
+		t.Errorf("expected nil; got %v", err)
+	}
+}
+
+func TestRegenerateError(t *testing.T) {
+	errs := make(chan error, 1)
+	cache := NewTyped[string, string](false).OnRegenerateError(func(key string, err error) {
+		if key != "key" {
+			t.Errorf("expected key; got %q", key)
+		}
+		errs <- err
+	})
+
+	cache.Set("key", "old", 10*time.Millisecond, func() (string, error) {
+		return "", errRegenerate
+	})
+	time.Sleep(20 * time.Millisecond)
+	cache.Get("key")
+
+	select {
+	case err := <-errs:
+		if err != errRegenerate {
+			t.Errorf("expected %v; got %v", errRegenerate, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error")
+	}
+	if err := cache.RegenerateError("key"); err != errRegenerate {
+		t.Errorf("expected %v; got %v", errRegenerate, err)
+	}
+	// The stale value is still got.
+	if value, ok := cache.Get("key"); !ok || value != "old" {
+		t.Errorf("expected old; got %q", value)
+	}
+}
+
+func TestMaxStale(t *testing.T) {
+	evicted := make(chan EvictionReason, 1)
+	cache := NewTyped[string, string](true).
+		SetMaxStale(50 * time.Millisecond).
+		OnRegenerateError(func(string, error) {}).
+		OnEvicted(func(_ string, _ string, reason EvictionReason) { evicted <- reason })
+	defer cache.Close()
+
+	cache.Set("key", "old", 10*time.Millisecond, func() (string, error) {
+		return "", errRegenerate
+	})
+
+	time.Sleep(30 * time.Millisecond)
+	if value, ok := cache.Get("key"); !ok || value != "old" {
+		t.Errorf("expected old; got %q", value)
+	}
+
+	select {
+	case reason := <-evicted:
+		if reason != Expired {
+			t.Errorf("expected expired; got %s", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no eviction")
+	}
+	if _, ok := cache.Get("key"); ok {
+		t.Error("expected not ok; got ok")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cache := NewTyped[string, string](true).
+		SetBackoff(20 * time.Millisecond).
+		OnRegenerateError(func(string, error) {})
+	defer cache.Close()
+
+	var calls atomic.Int32
+	cache.Set("key", "old", 10*time.Millisecond, func() (string, error) {
+		calls.Add(1)
+		return "", errRegenerate
+	})
+	// The value duration is 10ms, so failures are retried at most every 10ms.
+	time.Sleep(45 * time.Millisecond)
+	if n := calls.Load(); n < 3 {
+		t.Errorf("expected at least 3 calls; got %d", n)
+	}
+
+	var backoffCalls atomic.Int32
+	cache.Set("key", "old", time.Second, func() (string, error) {
+		backoffCalls.Add(1)
+		return "", errRegenerate
+	})
+	time.Sleep(1250 * time.Millisecond)
+	// Regenerated after 1s, then retried after 20ms, 40ms, 80ms and 160ms.
+	if n := backoffCalls.Load(); n < 3 || n > 5 {
+		t.Errorf("expected 3 to 5 calls; got %d", n)
+	}
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+)
+
+const (
+	sketchDepth   = 4
+	sketchMaxFreq = 15
+)
+
+// sketch is a count-min sketch estimating the frequency of keys.
+// Counters are halved periodically, so that old uses fade away.
+type sketch[K comparable] struct {
+	seed     maphash.Seed
+	counters [sketchDepth][]uint8
+	mask     uint64
+	adds     int
+	sample   int
+}
+
+// newSketch returns a sketch with about 8 counters per row for each of
+// capacity keys, which keeps collisions rare.
+func newSketch[K comparable](capacity int) *sketch[K] {
+	width := 16
+	for width < 8*capacity {
+		width *= 2
+	}
+
+	s := &sketch[K]{seed: maphash.MakeSeed(), mask: uint64(width - 1), sample: 10 * capacity}
+	for i := range s.counters {
+		s.counters[i] = make([]uint8, width)
+	}
+
+	return s
+}
+
+func (s *sketch[K]) index(h uint64, i int) uint64 {
+	h1, h2 := h&0xffffffff, h>>32
+	return (h1 + uint64(i)*h2) & s.mask
+}
+
+func (s *sketch[K]) add(key K) {
+	h := maphash.Comparable(s.seed, key)
+	for i := range s.counters {
+		if c := &s.counters[i][s.index(h, i)]; *c < sketchMaxFreq {
+			*c++
+		}
+	}
+
+	if s.adds++; s.adds >= s.sample {
+		for i := range s.counters {
+			for j := range s.counters[i] {
+				s.counters[i][j] /= 2
+			}
+		}
+		s.adds /= 2
+	}
+}
+
+func (s *sketch[K]) estimate(key K) uint8 {
+	h := maphash.Comparable(s.seed, key)
+	min := uint8(sketchMaxFreq)
+	for i := range s.counters {
+		if c := s.counters[i][s.index(h, i)]; c < min {
+			min = c
+		}
+	}
+
+	return min
+}
+
+type segment int
+
+const (
+	window segment = iota
+	probation
+	protected
+)
+
+type tinyLFUEntry[K comparable] struct {
+	key     K
+	segment segment
+}
+
+// tinyLFU implements the W-TinyLFU policy: new keys enter an LRU window
+// holding about 1% of the keys. Keys leaving the window are admitted into
+// a segmented LRU main space only if they are estimated to be used more
+// frequently than its victim. Keys used again while in probation are
+// promoted to the protected segment, holding about 80% of the main space.
+type tinyLFU[K comparable] struct {
+	sketch   *sketch[K]
+	segments [3]*list.List
+	elems    map[K]*list.Element
+}
+
+func newTinyLFU[K comparable](capacity int) *tinyLFU[K] {
+	if capacity <= 0 {
+		capacity = 1024
+	}
+
+	p := &tinyLFU[K]{sketch: newSketch[K](capacity), elems: make(map[K]*list.Element)}
+	for i := range p.segments {
+		p.segments[i] = list.New()
+	}
+
+	return p
+}
+
+func (p *tinyLFU[K]) windowCap() int {
+	return max(1, len(p.elems)/100)
+}
+
+func (p *tinyLFU[K]) move(e *list.Element, to segment) *list.Element {
+	entry := e.Value.(*tinyLFUEntry[K])
+	p.segments[entry.segment].Remove(e)
+	entry.segment = to
+	e = p.segments[to].PushFront(entry)
+	p.elems[entry.key] = e
+
+	return e
+}
+
+func (p *tinyLFU[K]) add(key K, full bool) {
+	p.sketch.add(key)
+	p.elems[key] = p.segments[window].PushFront(&tinyLFUEntry[K]{key: key, segment: window})
+
+	// Without pressure, keys leave the window for the main space freely.
+	// Otherwise victim decides whether to admit them.
+	if !full {
+		for p.segments[window].Len() > p.windowCap() {
+			p.move(p.segments[window].Back(), probation)
+		}
+	}
+}
+
+func (p *tinyLFU[K]) access(key K) {
+	p.sketch.add(key)
+	e, ok := p.elems[key]
+	if !ok {
+		return
+	}
+
+	switch e.Value.(*tinyLFUEntry[K]).segment {
+	case window:
+		p.segments[window].MoveToFront(e)
+	case probation:
+		p.move(e, protected)
+		main := p.segments[probation].Len() + p.segments[protected].Len()
+		for p.segments[protected].Len() > max(1, main*8/10) {
+			p.move(p.segments[protected].Back(), probation)
+		}
+	case protected:
+		p.segments[protected].MoveToFront(e)
+	}
+}
+
+func (p *tinyLFU[K]) remove(key K) {
+	if e, ok := p.elems[key]; ok {
+		p.segments[e.Value.(*tinyLFUEntry[K]).segment].Remove(e)
+		delete(p.elems, key)
+	}
+}
+
+func (p *tinyLFU[K]) mainVictim() *list.Element {
+	if e := p.segments[probation].Back(); e != nil {
+		return e
+	}
+
+	return p.segments[protected].Back()
+}
+
+func (p *tinyLFU[K]) victim() K {
+	victim := p.mainVictim()
+	if p.segments[window].Len() > p.windowCap() || victim == nil {
+		candidate := p.segments[window].Back()
+		if victim == nil {
+			return candidate.Value.(*tinyLFUEntry[K]).key
+		}
+
+		// Admit the candidate only if it is used more than the victim.
+		key := candidate.Value.(*tinyLFUEntry[K]).key
+		if p.sketch.estimate(key) <= p.sketch.estimate(victim.Value.(*tinyLFUEntry[K]).key) {
+			return key
+		}
+		p.move(candidate, probation)
+	}
+
+	return victim.Value.(*tinyLFUEntry[K]).key
+}